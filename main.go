@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 
 	kaizen "github.com/serene-brew/Kaizen/src"
 )
@@ -14,19 +13,33 @@ func main() {
 	// perform auto-heal check before starting kaizen
 	kaizen.AutoHeal()
 
-	// check whether MPV-player is installed or not
-	_, err := exec.LookPath("mpv")
-	if err != nil {
-		fmt.Println("[!] Please install MPV-player using your package manager before running kaizen")
-		os.Exit(1)
+	// playback needs a player, but browsing and downloading work without one
+	if err := kaizen.CheckPlayer(); err != nil {
+		fmt.Printf("\033[0;33m [!] %v \033[0m\n", err)
 	}
 
 	// kaizen CLI flags
 	uninstalFlag := flag.Bool("uninstall", false, "Run the uninstaller script")
 	updateFlag := flag.Bool("update", false, "Run the update script")
 	versionFlag := flag.Bool("v", false, "views version information")
+	offlineFlag := flag.Bool("offline", false, "browse cached results and play downloaded episodes without using the network")
 	flag.Parse()
 
+	kaizen.SetOfflineMode(*offlineFlag)
+
+	// subcommands that serve over HTTP instead of starting the TUI
+	serveCommands := map[string]func([]string) error{
+		"serve":        kaizen.ServeLibrary,
+		"serve-stream": kaizen.ServeStream,
+	}
+	if serve, ok := serveCommands[flag.Arg(0)]; ok {
+		if err := serve(flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "\033[0;31m [!] %v \033[0m\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *uninstalFlag {
 		kaizen.RunUninstalScript()
 	} else if *versionFlag {
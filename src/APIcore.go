@@ -1,11 +1,15 @@
 package src
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 /*
@@ -35,9 +39,31 @@ type Episodes struct {
 	Dub []string `json:"dub"`
 }
 
-// ApiResponse represents the overall API response structure
+// ApiResponse represents the overall API response structure.
+// The paging fields are optional; when the API omits them the response is treated as the only page.
 type AnimeResponse struct {
-	Result []Anime `json:"result"`
+	Result      []Anime `json:"result"`
+	Page        int     `json:"page"`
+	HasNextPage bool    `json:"hasNextPage"`
+	TotalPages  int     `json:"totalPages"`
+	Total       int     `json:"total"`
+}
+
+/*
+searchPage is a single page of search results as returned by extractInfo.
+Rows keep the index-based layout used by the results table, and the paging
+fields tell the table whether more results can be requested for the same query.
+stale is set when the page was served from the cache because the API could not
+be reached; fetchedAt is when its data last came from the API.
+*/
+type searchPage struct {
+	query     string
+	page      int
+	rows      [][]any
+	hasNext   bool
+	total     int
+	stale     bool
+	fetchedAt time.Time
 }
 
 /*
@@ -49,32 +75,46 @@ type StreamUtils struct {
 }
 
 /*
-extractInfo is a function that fetches information about an anime based on a given query string.
-The query string is used to build the API URL, and an HTTP GET request is sent to fetch the data.
-The function parses the JSON response and returns the Result field as a slice of slices of interface{}.
-If an error occurs at any stage, it is returned.
+extractInfo is a function that fetches one page of information about an anime based on a given query string.
+The query string and page number are used to build the API URL, and an HTTP GET request is sent to fetch the data.
+Pages are numbered from 1; the first page is requested without a page parameter.
+The function parses the JSON response and returns the rows along with the paging information.
+Responses go through the cache (see cachedJSON), and when neither the API nor the cached
+query can answer, an offline first page falls back to matching the cached anime metadata.
+If an error occurs at any stage, it is returned as an *APIError; a first page without results is
+reported as ErrEmptyResult.
 
 resp -> string(animeID), string(animeName), float64(subEpisodes), float64(dubEpisodes), []string, []string, string(englishName), string(description), []string(genres), string(status), string(type), string(rating) -> [][]interface{}
 */
-func extractInfo(query string) ([][]any, error) {
-	apiURL := "https://heavenscape.vercel.app/api/anime/search/" + strings.ReplaceAll(query, " ", "+")
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching data: %v", err)
+func extractInfo(ctx context.Context, query string, page int) (searchPage, error) {
+	if page < 1 {
+		page = 1
 	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %v", err)
+	apiURL := "https://heavenscape.vercel.app/api/anime/search/" + strings.ReplaceAll(query, " ", "+")
+	if page > 1 {
+		apiURL += "?page=" + strconv.Itoa(page)
 	}
 
 	// Parse the JSON response into ApiResponse struct
 	var apiResponse AnimeResponse
-	err = json.Unmarshal(body, &apiResponse)
+	key := fmt.Sprintf("search:%s:%d", strings.ToLower(strings.TrimSpace(query)), page)
+	fetchedAt, stale, err := cachedJSON(ctx, "search", apiURL, key, conf.CacheSearchTTL, &apiResponse)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %v", err)
+		if page > 1 || !asAPIError("search", err).Unavailable() {
+			return searchPage{}, err
+		}
+		apiResponse = AnimeResponse{Result: searchCachedAnime(query)}
+		if len(apiResponse.Result) == 0 {
+			return searchPage{}, err
+		}
+		stale = true
+	} else if !stale {
+		cacheAnime(apiResponse.Result)
+	}
+
+	// an empty first page means the query matched nothing, which the UI reports differently from a failure
+	if page == 1 && len(apiResponse.Result) == 0 {
+		return searchPage{}, &APIError{Kind: ErrEmptyResult, Op: "search", URL: apiURL}
 	}
 
 	// Process the data into [][]interface{}
@@ -103,40 +143,72 @@ func extractInfo(query string) ([][]any, error) {
 		result = append(result, row)
 	}
 
-	return result, nil
+	return searchPage{
+		query:     query,
+		page:      page,
+		rows:      result,
+		hasNext:   len(result) > 0 && (apiResponse.HasNextPage || apiResponse.TotalPages > page),
+		total:     apiResponse.Total,
+		stale:     stale,
+		fetchedAt: fetchedAt,
+	}, nil
 }
 
 /*
-getStreamLink is a function that retrieves the direct streaming link for a specific anime episode.
-It takes the anime ID, episode type (e.g., "sub" or "dub"), and episode number as arguments.
-The function constructs the API URL, sends an HTTP GET request, and parses the JSON response to extract the link.
-If an error occurs at any point, it is returned along with an empty string.
-
-resp -> string [Stream link]
+getJSON is a function that sends an HTTP GET request to apiURL through the shared apiClient
+and decodes the JSON body into v. The request is bound to ctx, so it is abandoned when ctx is cancelled.
+Failures are reported as *APIError values tagged with op: transport failures as ErrNetwork,
+non-200 responses as ErrHTTPStatus (so an HTML error page is never fed to the JSON decoder)
+and malformed bodies as ErrDecode.
 */
-func getStreamLink(id string, espisodeType string, episodeNumber string) (string, error) {
-	apiURL := "https://heavenscape.vercel.app/api/anime/search/" + id + "/" + espisodeType + "/" + episodeNumber
-
-	resp, err := http.Get(apiURL)
+func getJSON(ctx context.Context, op, apiURL string, v any) error {
+	resp, err := apiClient.Get(ctx, apiURL)
 	if err != nil {
-		return "", err
+		return &APIError{Kind: ErrNetwork, Op: op, URL: apiURL, Err: err}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{Kind: ErrHTTPStatus, Op: op, URL: apiURL, StatusCode: resp.StatusCode, Err: fmt.Errorf("bad status: %s", resp.Status)}
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return &APIError{Kind: ErrNetwork, Op: op, URL: apiURL, Err: err}
 	}
 
+	if err := json.Unmarshal(body, v); err != nil {
+		return &APIError{Kind: ErrDecode, Op: op, URL: apiURL, Err: err}
+	}
+	return nil
+}
+
+/*
+getStreamLink is a function that retrieves the direct streaming link for a specific anime episode.
+It takes the anime ID, episode type (e.g., "sub" or "dub"), and episode number as arguments.
+The function constructs the API URL, sends an HTTP GET request, and parses the JSON response to extract the link.
+If an error occurs at any point, it is returned along with an empty string; a response without
+a link is reported as ErrEmptyResult.
+
+resp -> string [Stream link]
+*/
+func getStreamLink(ctx context.Context, id string, espisodeType string, episodeNumber string) (string, error) {
+	apiURL := "https://heavenscape.vercel.app/api/anime/search/" + url.PathEscape(id) + "/" + url.PathEscape(espisodeType) + "/" + url.PathEscape(episodeNumber)
+
 	var response StreamUtils
-	err = json.Unmarshal(body, &response)
-	if err != nil {
+	if err := getJSON(ctx, "stream link", apiURL, &response); err != nil {
 		return "", err
 	}
+	if response.Link == "" {
+		return "", &APIError{Kind: ErrEmptyResult, Op: "stream link", URL: apiURL}
+	}
 
 	return response.Link, nil
 }
 
+// refererURL is the endpoint getReferer reads the streaming referer from
+var refererURL = "https://heavenscape.vercel.app/reference.json"
+
 /*
 ReferenceData represents the structure of the reference.json endpoint
 which contains HTTP header information like referer.
@@ -153,23 +225,9 @@ If an error occurs at any point, it is returned along with an empty string.
 
 resp -> string [Referer URL]
 */
-func getReferer() (string, error) {
-	apiURL := "https://heavenscape.vercel.app/reference.json"
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
+func getReferer(ctx context.Context) (string, error) {
 	var refData ReferenceData
-	err = json.Unmarshal(body, &refData)
-	if err != nil {
+	if err := getJSON(ctx, "referer", refererURL, &refData); err != nil {
 		return "", err
 	}
 
@@ -52,6 +52,27 @@ func (m Tab1Model) renderHelpMenu() string {
 	content.WriteString(keyStyle.Render("?") + "            " + descStyle.Render("Show/hide this help menu") + "\n")
 	content.WriteString(keyStyle.Render("enter") + "        " + descStyle.Render("Perform action on focused element") + "\n")
 	content.WriteString(keyStyle.Render("ctrl+d") + "       " + descStyle.Render("Open the download manager") + "\n")
+	content.WriteString(keyStyle.Render("ctrl+r") + "       " + descStyle.Render("Retry a failed search") + "\n")
+
+	content.WriteString(sectionStyle.Render("Search Input") + "\n")
+	content.WriteString(keyStyle.Render("↑/↓") + "          " + descStyle.Render("Recall previous/next search query") + "\n")
+	content.WriteString(keyStyle.Render("→") + "            " + descStyle.Render("Accept the inline suggestion") + "\n")
+	content.WriteString(keyStyle.Render("ctrl+n/p") + "     " + descStyle.Render("Cycle through suggestions") + "\n")
+
+	content.WriteString(sectionStyle.Render("Search Results Table") + "\n")
+	content.WriteString(keyStyle.Render("/") + "            " + descStyle.Render("Filter results, e.g. type:TV score>7.5 dub>0") + "\n")
+	content.WriteString(keyStyle.Render("s/e/t") + "        " + descStyle.Render("Sort by score, episode count or title") + "\n")
+
+	content.WriteString(sectionStyle.Render("Sub/Dub Episode Lists") + "\n")
+	content.WriteString(keyStyle.Render(":/0-9") + "        " + descStyle.Render("Jump to an episode, or filter a range like 100-200") + "\n")
+	content.WriteString(keyStyle.Render("ctrl+o") + "       " + descStyle.Render("Serve the episode on a local URL for any player") + "\n")
+	content.WriteString(keyStyle.Render("●/⚆") + "          " + descStyle.Render("Watched/unwatched episode marker") + "\n")
+
+	content.WriteString(sectionStyle.Render("Library Tab") + "\n")
+	content.WriteString(keyStyle.Render("←/→") + "          " + descStyle.Render("Switch between shows and episodes") + "\n")
+	content.WriteString(keyStyle.Render("enter") + "        " + descStyle.Render("Play the downloaded episode") + "\n")
+	content.WriteString(keyStyle.Render("d") + "            " + descStyle.Render("Delete the downloaded episode") + "\n")
+	content.WriteString(keyStyle.Render("r") + "            " + descStyle.Render("Rescan the download directory") + "\n")
 
 	content.WriteString(sectionStyle.Render("Download Manager Actions") + "\n")
 	content.WriteString(keyStyle.Render("esc") + "          " + descStyle.Render("Return back to app") + "\n")
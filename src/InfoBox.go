@@ -248,9 +248,6 @@ func (i *InfoBox) View() string {
 	}
 	if len(i.englishName) > 31 {
 		i.englishName = i.englishName[0:31] + "..."
-
-	} else {
-		i.englishName = i.englishName
 	}
 
 	// Build the metadata content
@@ -318,7 +315,7 @@ func (i *InfoBox) View() string {
 	// Thumbnail integation section
 	var left string
 	if i.thumbnailURL != "" {
-		seq, err := RenderKittyImageFromURL(i.thumbnailURL, 110, 150)
+		seq, err := RenderKittyImageFromURL(appCtx, i.thumbnailURL, 110, 150)
 		if err == nil && seq != "" {
 			imgStyle := lipgloss.NewStyle().
 				Width(15).
@@ -1,8 +1,10 @@
 package src
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
@@ -14,8 +16,9 @@ import (
 )
 
 var (
-	iconStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("2")) // Grey
-	keys      = newKeyMap()
+	iconStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("2")) // Grey
+	watchedIconStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	keys             = newKeyMap()
 )
 
 type (
@@ -24,11 +27,14 @@ type (
 		focus           focus
 		styles          Tab1styles
 		inputM          textinput.Model
+		filterM         textinput.Model
+		jumpM           textinput.Model
 		listOne         list.Model
 		listTwo         list.Model
 		table           table.Model
 		spinner         spinner.Model
 		infoBox         InfoBox
+		history         *SearchHistory
 		showDownloadBox bool
 		showHelpMenu    bool
 
@@ -36,6 +42,26 @@ type (
 		loadingMSG string
 		data       [][]any
 
+		filter    resultFilter
+		filterErr string
+		sortMode  resultSort
+
+		query        string
+		page         int
+		hasNextPage  bool
+		totalResults int
+		loadingMore  bool
+		banner       ErrorBanner
+		retryPage    int
+		stale        bool
+		fetchedAt    time.Time
+
+		watched    *WatchHistory
+		jumpTarget focus
+		jumpErr    string
+		subRange   episodeRange
+		dubRange   episodeRange
+
 		width  int
 		height int //nolint:unused
 
@@ -47,6 +73,8 @@ type (
 		dubSelectedNum       string
 		episodeType          string
 		streamLink           string
+		proxyLink            string
+		proxyCopied          bool
 		availableSubEpisodes []string
 		availableDubEpisodes []string
 
@@ -60,8 +88,10 @@ type (
 	}
 )
 type item struct {
-	title string
-	style string
+	title   string
+	style   string
+	ref     EpisodeRef
+	watched bool
 }
 
 const (
@@ -70,12 +100,17 @@ const (
 	inputFocus
 	tableFocus
 	infoBoxFocus
+	filterFocus
+	jumpFocus
 )
 
 func (i item) Title() string {
 	if i.style == "none" {
 		return "" + i.title
 	}
+	if i.watched {
+		return watchedIconStyle.Render("● ") + i.title
+	}
 	return iconStyle.Render("⚆ ") + i.title
 }
 
@@ -96,6 +131,22 @@ func NewTab1Model() Tab1Model {
 	input.Placeholder = "search your anime"
 	input.Focus()
 
+	// up/down are used for history recall, so suggestions are cycled with ctrl+n/ctrl+p
+	// and accepted with the right arrow like a shell autosuggestion
+	history := LoadSearchHistory(searchHistoryPath(), conf.SearchHistorySize)
+	input.ShowSuggestions = true
+	input.KeyMap.AcceptSuggestion = key.NewBinding(key.WithKeys("right"))
+	input.KeyMap.NextSuggestion = key.NewBinding(key.WithKeys("ctrl+n"))
+	input.KeyMap.PrevSuggestion = key.NewBinding(key.WithKeys("ctrl+p"))
+	input.SetSuggestions(history.Suggestions())
+
+	filterInput := textinput.New()
+	filterInput.Prompt = "filter ❯ "
+	filterInput.Placeholder = "status:ongoing type:TV score>7.5 dub>0 genre:romance"
+
+	jumpInput := textinput.New()
+	jumpInput.Prompt = "jump to episode ❯ "
+
 	spin := spinner.New()
 	spin.Spinner = spinner.Dot
 	spin.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(conf.Tab1SpinnerColor))
@@ -148,6 +199,9 @@ func NewTab1Model() Tab1Model {
 
 	return Tab1Model{
 		inputM:               input,
+		filterM:              filterInput,
+		jumpM:                jumpInput,
+		watched:              LoadWatchHistory(watchHistoryPath()),
 		listOne:              list1,
 		listTwo:              list2,
 		styles:               styles,
@@ -155,6 +209,7 @@ func NewTab1Model() Tab1Model {
 		table:                SearchResults,
 		spinner:              spin,
 		infoBox:              infoBox,
+		history:              history,
 		data:                 [][]interface{}{},
 		loading:              false,
 		loadingMSG:           "Searching for results...",
@@ -165,6 +220,21 @@ func NewTab1Model() Tab1Model {
 	}
 }
 
+/*
+ * recordSearch
+ * ------------
+ * Stores a submitted query (and optionally the titles returned for it) in the
+ * search history, persists it and refreshes the input's completion suggestions.
+ */
+func (m *Tab1Model) recordSearch(query string, titles ...string) {
+	if query != "" {
+		m.history.Add(query)
+	}
+	m.history.AddTitles(titles...)
+	m.history.Save() //nolint:errcheck
+	m.inputM.SetSuggestions(m.history.Suggestions())
+}
+
 func (m Tab1Model) Init() tea.Cmd {
 	return nil
 }
@@ -202,10 +272,37 @@ func (m Tab1Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		// the filter bar takes every key while it is open, including the focus shortcuts
+		if m.focus == filterFocus {
+			return m.updateFilterBar(msg)
+		}
+		if m.focus == jumpFocus {
+			return m.updateJumpPrompt(msg)
+		}
+
 		switch {
 		case key.Matches(msg, keys.Help):
 			m.showHelpMenu = !m.showHelpMenu
 			return m, nil
+		case m.retryPage > 0 && key.Matches(msg, keys.Retry):
+			return m, m.retrySearch()
+		case m.focus == tableFocus && key.Matches(msg, keys.Filter):
+			m.focus = filterFocus
+			m.filterM.CursorEnd()
+			return m, m.filterM.Focus()
+		case m.focus == tableFocus && key.Matches(msg, keys.SortScore):
+			m.toggleSort(sortScore)
+			return m, nil
+		case m.focus == tableFocus && key.Matches(msg, keys.SortEpisodes):
+			m.toggleSort(sortEpisodes)
+			return m, nil
+		case m.focus == tableFocus && key.Matches(msg, keys.SortTitle):
+			m.toggleSort(sortTitle)
+			return m, nil
+		case (m.focus == listOneFocus || m.focus == listTwoFocus) && m.animeID != "" && key.Matches(msg, keys.JumpEpisode):
+			return m, m.openJumpPrompt(strings.TrimPrefix(msg.String(), ":"))
+		case (m.focus == listOneFocus || m.focus == listTwoFocus) && m.animeID != "" && key.Matches(msg, keys.ServeStream):
+			return m, m.serveSelectedEpisode()
 		case key.Matches(msg, keys.List1):
 			m.focus = listOneFocus
 			m.infoBox.Blur()
@@ -300,6 +397,11 @@ func (m Tab1Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.score = 0.0
 					}
 
+					m.subRange = episodeRange{}
+					m.dubRange = episodeRange{}
+					m.listOne.Title = "Sub"
+					m.listTwo.Title = "Dub"
+
 					m.rating = strings.TrimSpace(m.table.SelectedRow()[5])
 					m.status = strings.TrimSpace(m.table.SelectedRow()[6])
 					m.focus = listOneFocus
@@ -400,6 +502,24 @@ func (m Tab1Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.infoBox, infoBoxCmd = m.infoBox.Update(msg)
 		cmds = append(cmds, infoBoxCmd)
 	} else if m.focus == inputFocus {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, keys.HistoryPrev):
+				if query, ok := m.history.Prev(m.inputM.Value()); ok {
+					m.inputM.SetValue(query)
+					m.inputM.CursorEnd()
+				}
+				return m, nil
+			case key.Matches(msg, keys.HistoryNext):
+				if query, ok := m.history.Next(); ok {
+					m.inputM.SetValue(query)
+					m.inputM.CursorEnd()
+				}
+				return m, nil
+			default:
+				m.history.ResetCursor()
+			}
+		}
 		m.inputM, cmd = m.inputM.Update(msg)
 		cmds = append(cmds, cmd)
 	} else if m.focus == listOneFocus {
@@ -407,7 +527,7 @@ func (m Tab1Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 	} else if m.focus == tableFocus {
 		m.table, cmd = m.table.Update(msg)
-		cmds = append(cmds, cmd)
+		cmds = append(cmds, cmd, m.loadMoreResults())
 	} else {
 		m.listTwo, cmd = m.listTwo.Update(msg)
 		cmds = append(cmds, cmd)
@@ -416,6 +536,83 @@ func (m Tab1Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+/*
+ * updateFilterBar
+ * ---------------
+ * Handles key presses while the results filter bar is focused. The filter is
+ * re-applied on every keystroke; enter keeps it and returns to the table while
+ * esc clears it. Invalid expressions keep the last valid filter and show an error.
+ */
+func (m Tab1Model) updateFilterBar(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.focus = tableFocus
+		m.filterM.Blur()
+		return m, nil
+	case "esc":
+		m.focus = tableFocus
+		m.filterM.Blur()
+		m.filterM.SetValue("")
+		m.filter = resultFilter{}
+		m.filterErr = ""
+		m.refreshResults()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.filterM, cmd = m.filterM.Update(msg)
+
+	f, err := parseResultFilter(m.filterM.Value())
+	if err != nil {
+		m.filterErr = err.Error()
+		return m, cmd
+	}
+	m.filter = f
+	m.filterErr = ""
+	m.refreshResults()
+	return m, cmd
+}
+
+// toggleSort switches to the given sort order, or back to API order if it is already active
+func (m *Tab1Model) toggleSort(order resultSort) {
+	if m.sortMode == order {
+		m.sortMode = sortNone
+	} else {
+		m.sortMode = order
+	}
+	m.refreshResults()
+}
+
+/*
+ * resultsBarView
+ * --------------
+ * Renders the bar shown above the results table once there are results or a
+ * filter is being typed: the filter input, the sort order and an "N of M results"
+ * indicator, plus a notice while the next page is being fetched.
+ */
+func (m Tab1Model) resultsBarView() string {
+	if !m.filterM.Focused() && len(m.data) == 0 {
+		return ""
+	}
+
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("242"))
+	bar := ""
+	if m.filterM.Focused() || !m.filter.empty() {
+		bar = m.filterM.View() + "  "
+	}
+	bar += dim.Render(fmt.Sprintf("sort: %s • %s", m.sortMode, m.resultCountText()))
+	if badge := m.staleBadge(); badge != "" {
+		bar += lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500")).Render("  " + badge)
+	}
+	if m.loadingMore {
+		bar += lipgloss.NewStyle().Foreground(lipgloss.Color(conf.Tab1SpinnerMsgColor)).Render("  loading more...")
+	}
+	if m.filterErr != "" {
+		bar += lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render("  " + m.filterErr)
+	}
+	return lipgloss.NewStyle().PaddingLeft(2).Render(bar)
+}
+
 /*
  * View
  * -----
@@ -440,6 +637,12 @@ func (m Tab1Model) View() string {
 	list1 := m.styles.list1Border.Render(m.listOne.View())
 	list2 := m.styles.list2Border.Render(m.listTwo.View())
 	tableS := m.styles.tableBorder.Render(m.table.View())
+	if bar := m.resultsBarView(); bar != "" {
+		tableS = lipgloss.JoinVertical(lipgloss.Left, bar, tableS)
+	}
+	if banner := m.banner.View(); banner != "" {
+		tableS = lipgloss.JoinVertical(lipgloss.Left, banner, tableS)
+	}
 
 	var boxView string
 
@@ -460,13 +663,25 @@ func (m Tab1Model) View() string {
 			asciiS.Render(ascii))
 	}
 
+	helpHint := "\n" + HelpTitle.Render("  esc") + HelpDesc.Render(" exit ") +
+		HelpDesc.Render("•") + HelpTitle.Render(" ?") + HelpDesc.Render(" help")
+	if m.proxyLink != "" {
+		copied := ""
+		if m.proxyCopied {
+			copied = " (copied)"
+		}
+		helpHint += HelpDesc.Render("   •") + HelpTitle.Render(" stream ") + HelpDesc.Render(m.proxyLink+copied)
+	}
+	if prompt := m.jumpPromptView(); prompt != "" {
+		helpHint = prompt
+	}
+
 	mainLayout := lipgloss.JoinVertical(
 		lipgloss.Top,
 		inputS,
 		tableS,
 		bottomLayout,
-		"\n"+HelpTitle.Render("  esc")+HelpDesc.Render(" exit ")+
-			HelpDesc.Render("•")+HelpTitle.Render(" ?")+HelpDesc.Render(" help"))
+		helpHint)
 
 	if m.showHelpMenu {
 		helpMenu := m.renderHelpMenu()
@@ -498,8 +713,7 @@ func (m Tab1Model) View() string {
 				lipgloss.NewStyle().Foreground(lipgloss.Color(conf.Tab1SpinnerMsgColor)).Render(m.loadingMSG)),
 			tableS,
 			bottomLayout,
-			"\n"+HelpTitle.Render("  esc")+HelpDesc.Render(" exit ")+
-				HelpDesc.Render("•")+HelpTitle.Render(" ?")+HelpDesc.Render(" help"))
+			helpHint)
 	}
 
 	return mainLayout
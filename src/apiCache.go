@@ -0,0 +1,190 @@
+package src
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+offlineMode is set by the --offline flag. While it is on the shared HTTP client refuses
+every request, so searches are answered from the cache and only downloaded episodes
+can be played.
+*/
+var offlineMode bool
+
+// errOffline is returned for any network request made while offlineMode is on
+var errOffline = errors.New("offline mode")
+
+// SetOfflineMode switches offline mode on or off; main calls it for the --offline flag
+func SetOfflineMode(offline bool) {
+	offlineMode = offline
+}
+
+// responseCache is the on-disk cache of search responses and anime metadata
+var responseCache = newAPICache(apiCachePath())
+
+// apiCachePath returns where cached API responses are stored
+func apiCachePath() string {
+	return ExpandPath("~/.cache/kaizen/api")
+}
+
+/*
+apiCache stores API responses as one JSON file per key. Keys are hashed into the
+file name, and the key itself is kept inside the entry so entries can be listed
+by prefix (e.g. every cached "anime:" record for offline search).
+*/
+type apiCache struct {
+	dir string
+}
+
+// cacheEntry is the on-disk format of a single cached response
+type cacheEntry struct {
+	Key       string          `json:"key"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func newAPICache(dir string) *apiCache {
+	return &apiCache{dir: dir}
+}
+
+func (c *apiCache) file(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get decodes the entry stored under key into v and returns when it was fetched
+func (c *apiCache) Get(key string, v any) (time.Time, bool) {
+	data, err := os.ReadFile(c.file(key))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		return time.Time{}, false
+	}
+	if err := json.Unmarshal(entry.Data, v); err != nil {
+		return time.Time{}, false
+	}
+	return entry.FetchedAt, true
+}
+
+// Put stores v under key, stamped with the current time
+func (c *apiCache) Put(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cacheEntry{Key: key, FetchedAt: time.Now(), Data: raw})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmp := c.file(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file(key))
+}
+
+/*
+Each calls fn for every entry whose key starts with prefix. Entries older than maxAge
+are removed instead; a maxAge of zero or less keeps everything.
+*/
+func (c *apiCache) Each(prefix string, maxAge time.Duration, fn func(entry cacheEntry)) {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(c.dir, f.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var entry cacheEntry
+		if json.Unmarshal(data, &entry) != nil || !strings.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		if maxAge > 0 && time.Since(entry.FetchedAt) > maxAge {
+			os.Remove(path) //nolint:errcheck
+			continue
+		}
+		fn(entry)
+	}
+}
+
+/*
+cachedJSON is getJSON backed by the response cache. A cached entry younger than ttl is
+returned without touching the network. Otherwise the API is asked and the answer cached;
+when the API cannot be reached (or offline mode is on) an older cached entry is served
+instead and reported as stale. fetchedAt is when the returned data came from the API.
+
+The cached entry is only decoded into v when it is returned, so fields a live response
+leaves out are never filled in from an older one.
+*/
+func cachedJSON(ctx context.Context, op, apiURL, key string, ttl time.Duration, v any) (fetchedAt time.Time, stale bool, err error) {
+	var cached json.RawMessage
+	t, ok := responseCache.Get(key, &cached)
+	if ok && ttl > 0 && time.Since(t) < ttl && !offlineMode && json.Unmarshal(cached, v) == nil {
+		return t, false, nil
+	}
+
+	err = getJSON(ctx, op, apiURL, v)
+	if err == nil {
+		responseCache.Put(key, v) //nolint:errcheck
+		return time.Now(), false, nil
+	}
+	if apiErr := asAPIError(op, err); !apiErr.Unavailable() {
+		return time.Time{}, false, err
+	}
+	if ok {
+		// drop whatever a response cut off mid-body left in v before serving the cached one
+		reflect.ValueOf(v).Elem().SetZero()
+		if json.Unmarshal(cached, v) == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, err
+}
+
+// cacheAnime stores the metadata of every anime in a search response under its ID
+func cacheAnime(results []Anime) {
+	for _, anime := range results {
+		responseCache.Put("anime:"+anime.ID, anime) //nolint:errcheck
+	}
+}
+
+/*
+searchCachedAnime matches query against the titles of every anime in the metadata
+cache. It lets an offline search find shows that were seen under a different query.
+*/
+func searchCachedAnime(query string) []Anime {
+	query = strings.ToLower(strings.TrimSpace(query))
+	var found []Anime
+	responseCache.Each("anime:", conf.CacheMetadataTTL, func(entry cacheEntry) {
+		var anime Anime
+		if json.Unmarshal(entry.Data, &anime) != nil {
+			return
+		}
+		if strings.Contains(strings.ToLower(anime.Title), query) || strings.Contains(strings.ToLower(anime.EnglishName), query) {
+			found = append(found, anime)
+		}
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].Title < found[j].Title })
+	return found
+}
@@ -0,0 +1,114 @@
+package src
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedJSONFallsBackWhenUnavailable(t *testing.T) {
+	defaultClient, defaultCache := apiClient, responseCache
+	apiClient = newTestHTTPClient(0)
+	responseCache = newAPICache(t.TempDir())
+	defer func() {
+		apiClient, responseCache = defaultClient, defaultCache
+		SetOfflineMode(false)
+	}()
+
+	var calls int32
+	down := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"direct":"https://example.com/ep.mp4"}`)) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	var v StreamUtils
+	_, stale, err := cachedJSON(context.Background(), "stream link", server.URL, "k", time.Hour, &v)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	_, stale, err = cachedJSON(context.Background(), "stream link", server.URL, "k", time.Hour, &v)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "a fresh entry is served without a request")
+
+	down = true
+	v = StreamUtils{}
+	_, stale, err = cachedJSON(context.Background(), "stream link", server.URL, "k", 0, &v)
+	assert.NoError(t, err)
+	assert.True(t, stale, "an expired entry is served as stale when the API is down")
+	assert.Equal(t, "https://example.com/ep.mp4", v.Link)
+
+	SetOfflineMode(true)
+	_, stale, err = cachedJSON(context.Background(), "stream link", server.URL, "k", time.Hour, &v)
+	assert.NoError(t, err)
+	assert.True(t, stale)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "offline mode never touches the network")
+
+	_, _, err = cachedJSON(context.Background(), "stream link", server.URL, "missing", time.Hour, &v)
+	assert.ErrorIs(t, err, errOffline)
+}
+
+func TestCachedJSONDoesNotMergeExpiredEntry(t *testing.T) {
+	defaultClient, defaultCache := apiClient, responseCache
+	apiClient = newTestHTTPClient(0)
+	responseCache = newAPICache(t.TempDir())
+	defer func() { apiClient, responseCache = defaultClient, defaultCache }()
+
+	type page struct {
+		Items   []string       `json:"items"`
+		HasNext bool           `json:"hasNext"`
+		Counts  map[string]int `json:"counts"`
+	}
+	assert.NoError(t, responseCache.Put("k", page{Items: []string{"old"}, HasNext: true, Counts: map[string]int{"old": 1}}))
+
+	down := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"items":["new"],"counts":{"new":2}}`)) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	var v page
+	_, stale, err := cachedJSON(context.Background(), "search", server.URL, "k", 0, &v)
+	assert.NoError(t, err)
+	assert.False(t, stale)
+	assert.Equal(t, page{Items: []string{"new"}, Counts: map[string]int{"new": 2}}, v, "nothing is left over from the expired entry")
+
+	down = true
+	v = page{Items: []string{"partial"}, Counts: map[string]int{"partial": 3}}
+	_, stale, err = cachedJSON(context.Background(), "search", server.URL, "k", 0, &v)
+	assert.NoError(t, err)
+	assert.True(t, stale)
+	assert.Equal(t, page{Items: []string{"new"}, Counts: map[string]int{"new": 2}}, v, "the cached entry replaces v")
+}
+
+func TestSearchCachedAnime(t *testing.T) {
+	defaultCache := responseCache
+	responseCache = newAPICache(t.TempDir())
+	defer func() { responseCache = defaultCache }()
+
+	cacheAnime([]Anime{
+		{ID: "1", Title: "Sousou no Frieren", EnglishName: "Frieren: Beyond Journey's End"},
+		{ID: "2", Title: "Dungeon Meshi", EnglishName: "Delicious in Dungeon"},
+	})
+
+	found := searchCachedAnime("journey")
+	assert.Len(t, found, 1)
+	assert.Equal(t, "1", found[0].ID)
+	assert.Len(t, searchCachedAnime("DUNGEON"), 1)
+	assert.Empty(t, searchCachedAnime("naruto"))
+}
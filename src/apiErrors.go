@@ -0,0 +1,75 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIErrorKind classifies what went wrong while talking to the API
+type APIErrorKind int
+
+const (
+	// ErrNetwork means the request never got a response (DNS, refused connection, reset, ...)
+	ErrNetwork APIErrorKind = iota
+	// ErrHTTPStatus means the API answered with a non-200 status code
+	ErrHTTPStatus
+	// ErrDecode means the API answered 200 but the body was not the expected JSON
+	ErrDecode
+	// ErrEmptyResult means the request succeeded but returned nothing usable
+	ErrEmptyResult
+)
+
+/*
+APIError is returned by every function in APIcore.go. Op names the operation
+("search", "stream link", "referer") so the UI can explain what failed, and Kind
+lets callers tell "no results" apart from "service unavailable" with errors.As.
+*/
+type APIError struct {
+	Kind       APIErrorKind
+	Op         string
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	switch e.Kind {
+	case ErrNetwork:
+		return fmt.Sprintf("%s: network error: %v", e.Op, e.Err)
+	case ErrHTTPStatus:
+		return fmt.Sprintf("%s: server returned %d %s", e.Op, e.StatusCode, http.StatusText(e.StatusCode))
+	case ErrDecode:
+		return fmt.Sprintf("%s: unexpected response: %v", e.Op, e.Err)
+	default:
+		return fmt.Sprintf("%s: no results", e.Op)
+	}
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Unavailable reports whether the error means the service could not be reached or
+is failing on its side, as opposed to a request that simply found nothing.
+*/
+func (e *APIError) Unavailable() bool {
+	switch e.Kind {
+	case ErrNetwork, ErrDecode:
+		return true
+	case ErrHTTPStatus:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+	default:
+		return false
+	}
+}
+
+// asAPIError unwraps err into an *APIError, wrapping unknown errors as network errors
+func asAPIError(op string, err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return &APIError{Kind: ErrNetwork, Op: op, Err: err}
+}
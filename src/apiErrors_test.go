@@ -0,0 +1,78 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetJSONErrorKinds(t *testing.T) {
+	defaultClient := apiClient
+	apiClient = newTestHTTPClient(0)
+	defer func() { apiClient = defaultClient }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("<html>internal error</html>")) //nolint:errcheck
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/garbage":
+			w.Write([]byte("<html>not json</html>")) //nolint:errcheck
+		default:
+			w.Write([]byte(`{"direct":"https://example.com/ep.mp4"}`)) //nolint:errcheck
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		path        string
+		kind        APIErrorKind
+		unavailable bool
+	}{
+		{name: "Server error page", path: "/down", kind: ErrHTTPStatus, unavailable: true},
+		{name: "Not found", path: "/missing", kind: ErrHTTPStatus, unavailable: false},
+		{name: "Malformed body", path: "/garbage", kind: ErrDecode, unavailable: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var v StreamUtils
+			err := getJSON(context.Background(), "stream link", server.URL+tc.path, &v)
+
+			var apiErr *APIError
+			assert.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tc.kind, apiErr.Kind)
+			assert.Equal(t, tc.unavailable, apiErr.Unavailable())
+		})
+	}
+
+	var v StreamUtils
+	assert.NoError(t, getJSON(context.Background(), "stream link", server.URL+"/ok", &v))
+	assert.Equal(t, "https://example.com/ep.mp4", v.Link)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	err := getJSON(context.Background(), "search", closed.URL, &v)
+	assert.Equal(t, ErrNetwork, asAPIError("search", err).Kind)
+}
+
+func TestErrorBannerStates(t *testing.T) {
+	noResults := newErrorBanner("frieren", &APIError{Kind: ErrEmptyResult, Op: "search"}, true)
+	assert.Equal(t, `No results for "frieren"`, noResults.title)
+	assert.False(t, noResults.severe)
+	assert.False(t, noResults.retryable, "retrying an empty search would return the same thing")
+
+	unavailable := newErrorBanner("frieren", &APIError{Kind: ErrHTTPStatus, Op: "search", StatusCode: 503}, true)
+	assert.Equal(t, "Service unavailable", unavailable.title)
+	assert.True(t, unavailable.severe)
+	assert.True(t, unavailable.retryable)
+
+	assert.Empty(t, ErrorBanner{}.View(), "a hidden banner renders nothing")
+}
@@ -31,6 +31,46 @@ type Config struct {
 	Tab1KaizenAscciArtColor     string
 
 	DownloadToWorkingDirectory bool
+	DownloadDir                string
+	FilenameTemplate           string
+	MediaServerLayout          bool
+	VerifyDownloads            bool
+	DownloadWindow             string
+	DownloadRetries            int
+	DownloadRetryDelay         time.Duration
+	DownloadConnections        int
+
+	DownloaderBackend          string
+	DownloaderAria2RPC         string
+	DownloaderAria2Secret      string
+	DownloaderAria2Connections int
+	DownloaderYtDlpPath        string
+
+	HooksOnDownloadComplete string
+	HooksOnDownloadFailed   string
+	NotificationsDesktop    bool
+
+	SearchHistorySize int
+
+	PlayerName    string
+	PlayerMpvArgs []string
+	PlayerVlcArgs []string
+	PlayerCommand string
+
+	StreamProxyListen string
+	ServeListen       string
+	ServeToken        string
+
+	NetworkConnectTimeout    time.Duration
+	NetworkReadTimeout       time.Duration
+	NetworkMaxRetries        int
+	NetworkRetryDelay        time.Duration
+	NetworkRequestsPerSecond float64
+	NetworkProxy             string
+	NetworkUserAgent         string
+	NetworkHeaders           map[string]string
+	CacheSearchTTL           time.Duration
+	CacheMetadataTTL         time.Duration
 }
 
 /* LoadConfig function initializes the Config struct by reading values from a YAML configuration file.
@@ -42,6 +82,31 @@ func LoadConfig() Config {
 	configPath := ExpandPath("~/.config/kaizen")
 
 	viper.SetConfigFile(filepath.Join(configPath, "config.yaml"))
+
+	// defaults for settings that older config.yaml files do not have yet
+	viper.SetDefault("Network.ConnectTimeout", "10s")
+	viper.SetDefault("Network.ReadTimeout", "30s")
+	viper.SetDefault("Network.MaxRetries", 3)
+	viper.SetDefault("Network.RetryDelay", "500ms")
+	viper.SetDefault("Network.RequestsPerSecond", 5)
+	viper.SetDefault("Network.UserAgent", "Mozilla/5.0")
+	viper.SetDefault("FilenameTemplate", defaultFilenameTemplate)
+	viper.SetDefault("VerifyDownloads", true)
+	viper.SetDefault("DownloadRetries", 3)
+	viper.SetDefault("DownloadRetryDelay", "5s")
+	viper.SetDefault("DownloadConnections", 1)
+	viper.SetDefault("Downloader.Backend", "builtin")
+	viper.SetDefault("Downloader.Aria2RPC", "http://localhost:6800/jsonrpc")
+	viper.SetDefault("Downloader.Aria2Connections", 8)
+	viper.SetDefault("Downloader.YtDlpPath", "yt-dlp")
+	viper.SetDefault("Player.Name", "mpv")
+	viper.SetDefault("Player.MpvArgs", []string{"-fs", "--profile=fast"})
+	viper.SetDefault("Player.VlcArgs", []string{"--fullscreen"})
+	viper.SetDefault("StreamProxy.Listen", "127.0.0.1:0")
+	viper.SetDefault("Serve.Listen", "127.0.0.1:8788")
+	viper.SetDefault("Cache.SearchTTL", "24h")
+	viper.SetDefault("Cache.MetadataTTL", "720h")
+
 	err := viper.ReadInConfig()
 	if err != nil {
 		fmt.Println("\033[0;33m [!] Invoking Auto-Heal  \033[0m")
@@ -94,6 +159,46 @@ func LoadConfig() Config {
 	Tab1KaizenAscciArtColor := viper.GetString("Tab1.ASCII Art.color")
 
 	DownloadToWorkingDirectory := viper.GetBool("DownloadToWorkingDirectory")
+	DownloadDir := viper.GetString("DownloadDir")
+	FilenameTemplate := viper.GetString("FilenameTemplate")
+	MediaServerLayout := viper.GetBool("MediaServerLayout")
+	VerifyDownloads := viper.GetBool("VerifyDownloads")
+	DownloadWindow := viper.GetString("DownloadWindow")
+	DownloadRetries := viper.GetInt("DownloadRetries")
+	DownloadRetryDelay := viper.GetDuration("DownloadRetryDelay")
+	DownloadConnections := viper.GetInt("DownloadConnections")
+
+	DownloaderBackend := viper.GetString("Downloader.Backend")
+	DownloaderAria2RPC := viper.GetString("Downloader.Aria2RPC")
+	DownloaderAria2Secret := viper.GetString("Downloader.Aria2Secret")
+	DownloaderAria2Connections := viper.GetInt("Downloader.Aria2Connections")
+	DownloaderYtDlpPath := viper.GetString("Downloader.YtDlpPath")
+
+	HooksOnDownloadComplete := viper.GetString("Hooks.OnDownloadComplete")
+	HooksOnDownloadFailed := viper.GetString("Hooks.OnDownloadFailed")
+	NotificationsDesktop := viper.GetBool("Notifications.Desktop")
+
+	SearchHistorySize := viper.GetInt("SearchHistorySize")
+
+	PlayerName := viper.GetString("Player.Name")
+	PlayerMpvArgs := viper.GetStringSlice("Player.MpvArgs")
+	PlayerVlcArgs := viper.GetStringSlice("Player.VlcArgs")
+	PlayerCommand := viper.GetString("Player.Command")
+
+	StreamProxyListen := viper.GetString("StreamProxy.Listen")
+	ServeListen := viper.GetString("Serve.Listen")
+	ServeToken := viper.GetString("Serve.Token")
+
+	NetworkConnectTimeout := viper.GetDuration("Network.ConnectTimeout")
+	NetworkReadTimeout := viper.GetDuration("Network.ReadTimeout")
+	NetworkMaxRetries := viper.GetInt("Network.MaxRetries")
+	NetworkRetryDelay := viper.GetDuration("Network.RetryDelay")
+	NetworkRequestsPerSecond := viper.GetFloat64("Network.RequestsPerSecond")
+	NetworkProxy := viper.GetString("Network.Proxy")
+	NetworkUserAgent := viper.GetString("Network.UserAgent")
+	NetworkHeaders := viper.GetStringMapString("Network.Headers")
+	CacheSearchTTL := viper.GetDuration("Cache.SearchTTL")
+	CacheMetadataTTL := viper.GetDuration("Cache.MetadataTTL")
 
 	conf.defaultUnfocusedDark = defaultUnfocusedDark
 	conf.defaultUnfocusedLight = defaultUnfocusedLight
@@ -111,6 +216,46 @@ func LoadConfig() Config {
 	conf.Tab1KaizenAscciArtColor = Tab1KaizenAscciArtColor
 
 	conf.DownloadToWorkingDirectory = DownloadToWorkingDirectory
+	conf.DownloadDir = DownloadDir
+	conf.FilenameTemplate = FilenameTemplate
+	conf.MediaServerLayout = MediaServerLayout
+	conf.VerifyDownloads = VerifyDownloads
+	conf.DownloadWindow = DownloadWindow
+	conf.DownloadRetries = DownloadRetries
+	conf.DownloadRetryDelay = DownloadRetryDelay
+	conf.DownloadConnections = DownloadConnections
+
+	conf.DownloaderBackend = DownloaderBackend
+	conf.DownloaderAria2RPC = DownloaderAria2RPC
+	conf.DownloaderAria2Secret = DownloaderAria2Secret
+	conf.DownloaderAria2Connections = DownloaderAria2Connections
+	conf.DownloaderYtDlpPath = DownloaderYtDlpPath
+
+	conf.HooksOnDownloadComplete = HooksOnDownloadComplete
+	conf.HooksOnDownloadFailed = HooksOnDownloadFailed
+	conf.NotificationsDesktop = NotificationsDesktop
+
+	conf.SearchHistorySize = SearchHistorySize
+
+	conf.PlayerName = PlayerName
+	conf.PlayerMpvArgs = PlayerMpvArgs
+	conf.PlayerVlcArgs = PlayerVlcArgs
+	conf.PlayerCommand = PlayerCommand
+
+	conf.StreamProxyListen = StreamProxyListen
+	conf.ServeListen = ServeListen
+	conf.ServeToken = ServeToken
+
+	conf.NetworkConnectTimeout = NetworkConnectTimeout
+	conf.NetworkReadTimeout = NetworkReadTimeout
+	conf.NetworkMaxRetries = NetworkMaxRetries
+	conf.NetworkRetryDelay = NetworkRetryDelay
+	conf.NetworkRequestsPerSecond = NetworkRequestsPerSecond
+	conf.NetworkProxy = NetworkProxy
+	conf.NetworkUserAgent = NetworkUserAgent
+	conf.NetworkHeaders = NetworkHeaders
+	conf.CacheSearchTTL = CacheSearchTTL
+	conf.CacheMetadataTTL = CacheMetadataTTL
 
 	return conf
 }
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package src
+
+// freeSpace is not implemented on this platform; the free-space preflight is skipped
+func freeSpace(path string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,204 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// aria2PollInterval is how often a running aria2 download is asked for its progress
+var aria2PollInterval = 500 * time.Millisecond
+
+/*
+aria2Backend hands downloads to a running aria2 (aria2c --enable-rpc) through its
+JSON-RPC interface, so a single episode is fetched over several connections. aria2
+writes the file itself, so it has to run on this machine or share its file system.
+*/
+type aria2Backend struct {
+	url         string
+	secret      string
+	connections int
+	client      *http.Client
+}
+
+func newAria2Backend(url, secret string, connections int) *aria2Backend {
+	return &aria2Backend{
+		url:         url,
+		secret:      secret,
+		connections: min(max(connections, 1), 16),
+		// the RPC server is local: no proxy, retries or rate limiting from apiClient
+		client: &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{}},
+	}
+}
+
+// aria2Status is the part of aria2.tellStatus Kaizen looks at
+type aria2Status struct {
+	Status          string `json:"status"`
+	TotalLength     int64  `json:"totalLength,string"`
+	CompletedLength int64  `json:"completedLength,string"`
+	ErrorCode       string `json:"errorCode"`
+	ErrorMessage    string `json:"errorMessage"`
+}
+
+var aria2StatusFields = []string{"status", "totalLength", "completedLength", "errorCode", "errorMessage"}
+
+// call invokes an aria2 RPC method and decodes its result into result, which may be nil
+func (b *aria2Backend) call(ctx context.Context, method string, result any, params ...any) error {
+	if b.secret != "" {
+		params = append([]any{"token:" + b.secret}, params...)
+	}
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": "kaizen", "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid aria2 RPC address %q: %v", b.url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("could not reach aria2 at %s (is it running with --enable-rpc?): %v", b.url, err)
+	}
+	defer resp.Body.Close()
+
+	// aria2 reports failed calls with a JSON-RPC error object and a non-200 status
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("invalid reply from aria2 (%s): %v", resp.Status, err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("aria2 %s: %s", method, reply.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+/*
+options returns the aria2 options of t: the .part file as output, the stream headers
+and the HTTP proxy. aria2's own retries are off so the engine counts every attempt,
+and continue picks up the file an earlier attempt left.
+*/
+func (b *aria2Backend) options(c Config, t *transfer) map[string]any {
+	var headers []string
+	for name, values := range t.req.stream.Headers {
+		for _, value := range values {
+			headers = append(headers, name+": "+value)
+		}
+	}
+	sort.Strings(headers)
+
+	options := map[string]any{
+		"dir":                       t.req.savePath,
+		"out":                       filepath.Base(t.partPath),
+		"header":                    headers,
+		"continue":                  "true",
+		"allow-overwrite":           "true",
+		"auto-file-renaming":        "false",
+		"max-tries":                 "1",
+		"split":                     strconv.Itoa(b.connections),
+		"max-connection-per-server": strconv.Itoa(b.connections),
+	}
+	// like mpv, aria2 only supports http(s) proxies
+	if proxyURL, err := parseProxyURL(c.NetworkProxy); err == nil && proxyURL != nil &&
+		(proxyURL.Scheme == "http" || proxyURL.Scheme == "https") {
+		options["all-proxy"] = proxyURL.String()
+	}
+	return options
+}
+
+func (b *aria2Backend) attempt(ctx context.Context, t *transfer, pause <-chan bool) error {
+	var gid string
+	if err := b.call(ctx, "aria2.addUri", &gid, []string{t.req.stream.URL}, b.options(conf, t)); err != nil {
+		return err
+	}
+	defer func() {
+		// stop a download that is still running and drop it from aria2's list of stopped ones;
+		// either call fails harmlessly when there is nothing to do
+		cleanup, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		b.call(cleanup, "aria2.forceRemove", nil, gid)          //nolint:errcheck
+		b.call(cleanup, "aria2.removeDownloadResult", nil, gid) //nolint:errcheck
+	}()
+
+	ticker := time.NewTicker(aria2PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case paused := <-pause:
+			if !paused {
+				continue
+			}
+			if err := b.call(ctx, "aria2.pause", nil, gid); err != nil {
+				return err
+			}
+			for paused {
+				select {
+				case paused = <-pause:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if err := b.call(ctx, "aria2.unpause", nil, gid); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			var status aria2Status
+			if err := b.call(ctx, "aria2.tellStatus", &status, gid, aria2StatusFields); err != nil {
+				return err
+			}
+			t.downloaded, t.total = status.CompletedLength, status.TotalLength
+			switch status.Status {
+			case "complete":
+				return nil
+			case "error":
+				return aria2Error(status)
+			case "removed":
+				return errors.New("the download was removed from aria2")
+			}
+			t.report(nil)
+		}
+	}
+}
+
+// aria2HTTPStatus finds the HTTP status in aria2's error message for a rejected request
+var aria2HTTPStatus = regexp.MustCompile(`status=(\d{3})`)
+
+/*
+aria2Error turns a failed aria2 download into the errors the engine knows, so rejected
+requests and expired links are retried like with the built-in backend. The error codes
+are listed under EXIT STATUS in the aria2c manual.
+*/
+func aria2Error(status aria2Status) error {
+	if m := aria2HTTPStatus.FindStringSubmatch(status.ErrorMessage); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return &downloadStatusError{code: code, status: m[1] + " " + http.StatusText(code)}
+	}
+	switch status.ErrorCode {
+	case "2", "6", "19", "29": // time out, network problem, name resolution failed, server overloaded
+		return &transferError{op: "aria2", err: errors.New(status.ErrorMessage)}
+	}
+	return fmt.Errorf("aria2: %s (error %s)", status.ErrorMessage, status.ErrorCode)
+}
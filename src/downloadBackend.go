@@ -0,0 +1,41 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+downloadBackend moves the bytes of a download. attempt transfers t.req.stream into
+t.partPath, continuing whatever an earlier attempt left there, and keeps t.downloaded
+and t.total up to date, reporting progress with t.report. Like the built-in transfer
+it pauses while true is received on pause. Errors that retryableDownloadError accepts
+make the engine try again; retries, verification and the final rename are the same
+for every backend.
+*/
+type downloadBackend interface {
+	attempt(ctx context.Context, t *transfer, pause <-chan bool) error
+}
+
+// builtinBackend downloads with Kaizen's own HTTP client over a single connection
+type builtinBackend struct{}
+
+func (builtinBackend) attempt(ctx context.Context, t *transfer, pause <-chan bool) error {
+	return t.attempt(ctx, pause)
+}
+
+// configuredDownloadBackend returns the Downloader.Backend from config.yaml, warning about and ignoring an unknown one
+func configuredDownloadBackend() downloadBackend {
+	switch strings.ToLower(strings.TrimSpace(conf.DownloaderBackend)) {
+	case "", "builtin":
+		return builtinBackend{}
+	case "aria2":
+		return newAria2Backend(conf.DownloaderAria2RPC, conf.DownloaderAria2Secret, conf.DownloaderAria2Connections)
+	case "yt-dlp":
+		return ytDlpBackend{path: conf.DownloaderYtDlpPath}
+	}
+	fmt.Fprintf(os.Stderr, "\033[0;33m [!] Ignoring unknown Downloader.Backend %q, using builtin \033[0m \n", conf.DownloaderBackend)
+	return builtinBackend{}
+}
@@ -0,0 +1,222 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+aria2Stub stands in for aria2's JSON-RPC server. addUri writes the episode to the
+requested file at once; tellStatus reports it as active until finish returns true.
+*/
+type aria2Stub struct {
+	mu      sync.Mutex
+	methods []string
+	options map[string]any
+	finish  func(methods []string) bool
+}
+
+func (s *aria2Stub) called(method string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Contains(s.methods, method)
+}
+
+func (s *aria2Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var call struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods = append(s.methods, call.Method)
+
+	var token string
+	json.Unmarshal(call.Params[0], &token) //nolint:errcheck
+	if token != "token:secret" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": 1, "message": "Unauthorized"}}) //nolint:errcheck
+		return
+	}
+
+	var result any = "OK"
+	switch call.Method {
+	case "aria2.addUri":
+		json.Unmarshal(call.Params[2], &s.options)                                                                 //nolint:errcheck
+		os.WriteFile(filepath.Join(s.options["dir"].(string), s.options["out"].(string)), []byte("episode"), 0644) //nolint:errcheck
+		result = "2089b05ecca3d829"
+	case "aria2.tellStatus":
+		status := map[string]string{"status": "active", "totalLength": "7", "completedLength": "3"}
+		if s.finish(s.methods) {
+			status["status"], status["completedLength"] = "complete", "7"
+		}
+		result = status
+	}
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": "kaizen", "result": result}) //nolint:errcheck
+}
+
+func testAria2Engine(t *testing.T, stub *aria2Stub) *downloadEngine {
+	defaultInterval := aria2PollInterval
+	aria2PollInterval = 10 * time.Millisecond
+	server := httptest.NewServer(stub)
+	e := testDownloadEngine(t)
+	t.Cleanup(func() {
+		server.Close()
+		aria2PollInterval = defaultInterval
+	})
+	e.backend = newAria2Backend(server.URL, "secret", 4)
+	return e
+}
+
+func TestAria2BackendDownload(t *testing.T) {
+	polls := 0
+	stub := &aria2Stub{finish: func([]string) bool {
+		polls++
+		return polls > 2
+	}}
+	e := testAria2Engine(t, stub)
+	dir := t.TempDir()
+	stream := StreamDescriptor{URL: "https://cdn.example/ep.mp4", Headers: http.Header{"Referer": {"https://example.com/"}}}
+
+	id := e.Start(downloadRequest{stream: stream, savePath: dir, filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, int64(7), update.downloaded)
+	data, err := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, "episode", string(data))
+
+	assert.Equal(t, "ep.mp4.part", stub.options["out"])
+	assert.Equal(t, []any{"Referer: https://example.com/"}, stub.options["header"])
+	assert.Equal(t, "4", stub.options["split"])
+	assert.True(t, stub.called("aria2.removeDownloadResult"))
+}
+
+func TestAria2BackendPauseResume(t *testing.T) {
+	stub := &aria2Stub{finish: func(methods []string) bool {
+		return slices.Contains(methods, "aria2.unpause")
+	}}
+	e := testAria2Engine(t, stub)
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: "https://cdn.example/ep.mp4"}, savePath: t.TempDir(), filename: "ep.mp4"})
+	for update := range e.Events() {
+		if update.id == id && update.downloaded > 0 {
+			break
+		}
+	}
+	e.Pause(id)
+	assert.Eventually(t, func() bool { return stub.called("aria2.pause") }, time.Second, 5*time.Millisecond)
+	e.Resume(id)
+	assert.NoError(t, waitComplete(t, e, id).error)
+}
+
+func TestAria2BackendUnauthorized(t *testing.T) {
+	e := testAria2Engine(t, &aria2Stub{})
+	e.backend.(*aria2Backend).secret = "wrong"
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: "https://cdn.example/ep.mp4"}, savePath: t.TempDir(), filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.ErrorContains(t, update.error, "Unauthorized")
+	assert.Equal(t, 0, update.retries)
+}
+
+func TestAria2Error(t *testing.T) {
+	expired := aria2Error(aria2Status{ErrorCode: "22", ErrorMessage: "The response status is not successful. status=403"})
+	assert.True(t, linkExpired(expired))
+	assert.True(t, retryableDownloadError(expired))
+	assert.True(t, retryableDownloadError(aria2Error(aria2Status{ErrorCode: "6", ErrorMessage: "Network problem has occurred."})))
+	assert.False(t, retryableDownloadError(aria2Error(aria2Status{ErrorCode: "9", ErrorMessage: "There is not enough disk space available."})))
+}
+
+func TestYtDlpArgs(t *testing.T) {
+	tr := &transfer{
+		req: downloadRequest{stream: StreamDescriptor{
+			URL:     "https://cdn.example/ep.m3u8",
+			Headers: http.Header{"Referer": {"https://example.com/"}, "User-Agent": {"Mozilla/5.0"}},
+		}},
+		partPath: "/videos/100% Show/ep.mp4.part",
+	}
+	args := ytDlpArgs(Config{NetworkProxy: "socks5://127.0.0.1:1080"}, tr)
+
+	assert.Equal(t, "/videos/100%% Show/ep.mp4.part", args[slices.Index(args, "-o")+1])
+	assert.Contains(t, args, "Referer:https://example.com/")
+	assert.Contains(t, args, "User-Agent:Mozilla/5.0")
+	assert.Equal(t, "socks5://127.0.0.1:1080", args[slices.Index(args, "--proxy")+1])
+	assert.Equal(t, []string{"--", "https://cdn.example/ep.m3u8"}, args[len(args)-2:])
+}
+
+func TestParseYtDlpProgress(t *testing.T) {
+	tests := []struct {
+		line              string
+		downloaded, total int64
+		ok                bool
+	}{
+		{"kaizen-progress 1024 4096 NA", 1024, 4096, true},
+		{"kaizen-progress 1024 NA 8192.5", 1024, 8192, true},
+		{"kaizen-progress 1024 NA NA", 1024, 0, true},
+		{"kaizen-progress NA NA NA", 0, 0, false},
+		{"[download] Destination: ep.mp4", 0, 0, false},
+	}
+	for _, tt := range tests {
+		downloaded, total, ok := parseYtDlpProgress(tt.line)
+		assert.Equal(t, tt.ok, ok, tt.line)
+		assert.Equal(t, tt.downloaded, downloaded, tt.line)
+		assert.Equal(t, tt.total, total, tt.line)
+	}
+}
+
+func TestYtDlpError(t *testing.T) {
+	err := ytDlpError("WARNING: something\nERROR: unable to download video data: HTTP Error 410: Gone (caused by ...)\n", errors.New("exit status 1"))
+	assert.True(t, linkExpired(err))
+	assert.EqualError(t, ytDlpError("ERROR: Unsupported URL: https://example.com\n", nil), "yt-dlp: ERROR: Unsupported URL: https://example.com")
+	assert.EqualError(t, ytDlpError("", errors.New("exit status 2")), "yt-dlp: exit status 2")
+}
+
+func TestYtDlpBackendDownload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as yt-dlp")
+	}
+	// a stand-in yt-dlp that prints one progress line and saves the file passed with -o
+	script := filepath.Join(t.TempDir(), "yt-dlp")
+	assert.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+while [ $# -gt 0 ]; do
+	[ "$1" = "-o" ] && out="$2"
+	shift
+done
+echo "kaizen-progress 3 NA 7.0"
+printf episode > "$out"
+`), 0755))
+
+	e := testDownloadEngine(t)
+	e.backend = ytDlpBackend{path: script}
+	dir := t.TempDir()
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: "https://cdn.example/ep.mp4"}, savePath: dir, filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, int64(7), update.total)
+	data, err := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, "episode", string(data))
+}
+
+func TestYtDlpBackendNotFound(t *testing.T) {
+	e := testDownloadEngine(t)
+	e.backend = ytDlpBackend{path: filepath.Join(t.TempDir(), "missing-yt-dlp")}
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: "https://cdn.example/ep.mp4"}, savePath: t.TempDir(), filename: "ep.mp4"})
+	assert.ErrorContains(t, waitComplete(t, e, id).error, "failed to start yt-dlp")
+}
@@ -0,0 +1,662 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// errDownloadSuperseded is the error of a download stopped because a new one was started
+var errDownloadSuperseded = errors.New("download superseded by a new download")
+
+// isDownloadCancellation reports whether err means the download was stopped on purpose rather than failed
+func isDownloadCancellation(err error) bool {
+	return errors.Is(err, errDownloadCancelled) || errors.Is(err, errDownloadSuperseded)
+}
+
+/*
+downloadRequest is what a download needs: the stream and where to save it. resolve,
+when set, fetches a fresh stream link for retries after the old one expired. resume
+continues the .part file an earlier session left behind instead of starting over.
+*/
+type downloadRequest struct {
+	stream   StreamDescriptor
+	savePath string
+	filename string
+	resolve  func(context.Context) (StreamDescriptor, error)
+	resume   bool
+}
+
+type engineCommandKind int
+
+const (
+	engineStart engineCommandKind = iota
+	enginePause
+	engineResume
+	engineCancel
+	engineOverride
+)
+
+type engineCommand struct {
+	kind engineCommandKind
+	id   int
+	req  downloadRequest
+	on   bool
+}
+
+// downloadTask is the controller's handle on a running transfer
+type downloadTask struct {
+	cancel     context.CancelCauseFunc
+	pause      chan bool
+	userPaused bool
+}
+
+// setPaused tells the transfer whether to pause; only the controller calls it
+func (t *downloadTask) setPaused(paused bool) {
+	// only the controller sends, so after draining a stale state there is room for the new one
+	select {
+	case <-t.pause:
+	default:
+	}
+	t.pause <- paused
+}
+
+/*
+downloadEngine runs downloads. All job state is owned by the controller goroutine
+started by newDownloadEngine: the UI only sends it commands, and each transfer learns
+about pause and cancel through its own channel and context, so nothing is shared
+without synchronization. Only one transfer runs at a time; starting a new one
+supersedes the previous one. The bytes themselves are moved by the configured
+downloadBackend.
+
+The controller also keeps the download window: transfers are paused while it is
+closed, unless the user overrides it, and every change is announced on schedule.
+*/
+type downloadEngine struct {
+	nextID   atomic.Int64
+	window   downloadWindow
+	backend  downloadBackend
+	commands chan engineCommand
+	finished chan int
+	events   chan downloadStatusUpdate
+	schedule chan downloadSchedule
+}
+
+func newDownloadEngine(ctx context.Context, window downloadWindow, backend downloadBackend) *downloadEngine {
+	e := &downloadEngine{
+		window:   window,
+		backend:  backend,
+		commands: make(chan engineCommand),
+		finished: make(chan int),
+		events:   make(chan downloadStatusUpdate, 100),
+		schedule: make(chan downloadSchedule, 1),
+	}
+	go e.run(ctx)
+	return e
+}
+
+// Start queues a download and returns its ID
+func (e *downloadEngine) Start(req downloadRequest) int {
+	id := int(e.nextID.Add(1))
+	e.commands <- engineCommand{kind: engineStart, id: id, req: req}
+	return id
+}
+
+// Pause suspends the transfer of download id after its current read
+func (e *downloadEngine) Pause(id int) {
+	e.commands <- engineCommand{kind: enginePause, id: id}
+}
+
+// Resume continues a paused download
+func (e *downloadEngine) Resume(id int) {
+	e.commands <- engineCommand{kind: engineResume, id: id}
+}
+
+// Cancel stops download id; its final status update carries errDownloadCancelled
+func (e *downloadEngine) Cancel(id int) {
+	e.commands <- engineCommand{kind: engineCancel, id: id}
+}
+
+// Override lets downloads run outside the download window (on) or hands control back to the window
+func (e *downloadEngine) Override(on bool) {
+	e.commands <- engineCommand{kind: engineOverride, on: on}
+}
+
+// Events returns the channel progress and completion updates are sent on
+func (e *downloadEngine) Events() <-chan downloadStatusUpdate {
+	return e.events
+}
+
+// downloadUpdatesMsg carries the engine updates received since the last one, coalesced per download
+type downloadUpdatesMsg []downloadStatusUpdate
+
+/*
+listenDownloads blocks until the engine sends an update and returns it together with
+any others already waiting. The Update handler re-arms it after every message, so the
+UI wakes up only when something changed.
+*/
+func listenDownloads(e *downloadEngine) tea.Cmd {
+	return func() tea.Msg {
+		return downloadUpdatesMsg(coalesceUpdates(<-e.events, e.events))
+	}
+}
+
+// coalesceUpdates drains the waiting updates, keeping only the latest progress of each download
+func coalesceUpdates(first downloadStatusUpdate, events <-chan downloadStatusUpdate) []downloadStatusUpdate {
+	updates := []downloadStatusUpdate{first}
+	for {
+		select {
+		case update := <-events:
+			if last := &updates[len(updates)-1]; last.id == update.id && !last.complete {
+				*last = update
+			} else {
+				updates = append(updates, update)
+			}
+		default:
+			return updates
+		}
+	}
+}
+
+func (e *downloadEngine) run(ctx context.Context) {
+	tasks := make(map[int]*downloadTask)
+	state := downloadSchedule{open: true}
+
+	// boundary fires when the download window opens or closes; it stays nil without a window
+	var boundary <-chan time.Time
+	updateSchedule := func() {
+		now := time.Now()
+		state.open = state.override || e.window.Contains(now)
+		if e.window.set {
+			state.next = e.window.NextBoundary(now)
+			boundary = time.After(time.Until(state.next))
+		}
+		for _, task := range tasks {
+			task.setPaused(task.userPaused || !state.open)
+		}
+		select {
+		case <-e.schedule:
+		default:
+		}
+		e.schedule <- state
+	}
+	updateSchedule()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, task := range tasks {
+				task.cancel(ctx.Err())
+			}
+			return
+		case <-boundary:
+			updateSchedule()
+		case id := <-e.finished:
+			delete(tasks, id)
+		case cmd := <-e.commands:
+			switch cmd.kind {
+			case engineStart:
+				for _, task := range tasks {
+					task.cancel(errDownloadSuperseded)
+				}
+				taskCtx, cancel := context.WithCancelCause(ctx)
+				task := &downloadTask{cancel: cancel, pause: make(chan bool, 1)}
+				tasks[cmd.id] = task
+				if !state.open {
+					task.setPaused(true)
+				}
+				go func(id int) {
+					downloadFile(taskCtx, e.backend, id, task.pause, cmd.req, e.events)
+					select {
+					case e.finished <- id:
+					case <-ctx.Done():
+					}
+				}(cmd.id)
+			case enginePause, engineResume:
+				if task, ok := tasks[cmd.id]; ok {
+					task.userPaused = cmd.kind == enginePause
+					task.setPaused(task.userPaused || !state.open)
+				}
+			case engineCancel:
+				if task, ok := tasks[cmd.id]; ok {
+					task.cancel(errDownloadCancelled)
+				}
+			case engineOverride:
+				if state.override != cmd.on {
+					state.override = cmd.on
+					updateSchedule()
+				}
+			}
+		}
+	}
+}
+
+// maxDownloadRetryDelay caps the exponential backoff between download attempts
+const maxDownloadRetryDelay = 5 * time.Minute
+
+// downloadStatusError is a stream request answered with an unexpected status
+type downloadStatusError struct {
+	code   int
+	status string
+}
+
+func (e *downloadStatusError) Error() string {
+	return "bad status: " + e.status
+}
+
+// transferError is a network failure while fetching the stream
+type transferError struct {
+	op  string
+	err error
+}
+
+func (e *transferError) Error() string {
+	return e.op + ": " + e.err.Error()
+}
+
+func (e *transferError) Unwrap() error {
+	return e.err
+}
+
+// errConnectionClosed is returned when the server closed the connection before all announced bytes arrived
+var errConnectionClosed = errors.New("connection closed before the download was complete")
+
+// linkExpired reports whether err means the stream link is no longer valid and a fresh one is needed
+func linkExpired(err error) bool {
+	var statusErr *downloadStatusError
+	return errors.As(err, &statusErr) && (statusErr.code == http.StatusForbidden || statusErr.code == http.StatusGone)
+}
+
+/*
+retryableDownloadError reports whether a failed attempt is worth retrying: network
+errors, connections closed early, server errors, rate limiting and expired links.
+Local problems such as a full disk are not retried.
+*/
+func retryableDownloadError(err error) bool {
+	var statusErr *downloadStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusRequestTimeout ||
+			statusErr.code == http.StatusTooManyRequests || linkExpired(err)
+	}
+	var netErr *transferError
+	return errors.As(err, &netErr) || errors.Is(err, errConnectionClosed)
+}
+
+// downloadRetryDelay returns the wait before retry attempt (1-based): DownloadRetryDelay doubled per attempt
+func downloadRetryDelay(attempt int) time.Duration {
+	delay := conf.DownloadRetryDelay
+	for i := 1; i < attempt && delay < maxDownloadRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDownloadRetryDelay)
+}
+
+/*
+openStream requests the stream from offset on. A ranged request may be answered with
+the whole file (200) by servers without range support; the caller has to check.
+*/
+func openStream(ctx context.Context, stream StreamDescriptor, offset int64) (*http.Response, error) {
+	httpReq, err := stream.NewRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// the engine retries on its own, with DownloadRetries
+	resp, err := apiClient.DoOnce(httpReq)
+	if err != nil {
+		return nil, &transferError{op: "failed to fetch URL", err: err}
+	}
+	if resp.StatusCode != http.StatusOK && !(offset > 0 && resp.StatusCode == http.StatusPartialContent) {
+		resp.Body.Close()
+		return nil, &downloadStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return resp, nil
+}
+
+// transfer is the state of one download that is kept across attempts
+type transfer struct {
+	id         int
+	backend    downloadBackend
+	req        downloadRequest
+	events     chan<- downloadStatusUpdate
+	fullPath   string
+	partPath   string
+	file       *os.File
+	downloaded int64
+	total      int64
+	segments   []*segment
+	retries    int
+	lastUpdate time.Time
+}
+
+// progress returns the fraction downloaded, or 0.5 when the size is unknown
+func (t *transfer) progress() float64 {
+	if t.total <= 0 {
+		return 0.5
+	}
+	return float64(t.downloaded) / float64(max(t.total, t.downloaded))
+}
+
+// report sends a progress update, skipping it when the UI is behind since the next one replaces it anyway
+func (t *transfer) report(err error) {
+	select {
+	case t.events <- downloadStatusUpdate{
+		id:         t.id,
+		progress:   t.progress(),
+		complete:   false,
+		error:      err,
+		downloaded: t.downloaded,
+		total:      t.total,
+		retries:    t.retries,
+	}:
+	default:
+	}
+}
+
+/*
+downloadFile saves req.stream to req.savePath/req.filename with backend, reporting
+progress and the final result on events. Receiving true on pause suspends the transfer until false is
+received; cancelling ctx stops it with the context's cause as the error.
+
+Failed attempts are retried up to DownloadRetries times with exponential backoff,
+continuing from the bytes already saved. When the stream link has expired (403 or 410)
+a fresh one is resolved first.
+*/
+func downloadFile(ctx context.Context, backend downloadBackend, id int, pause <-chan bool, req downloadRequest, events chan<- downloadStatusUpdate) {
+	t := &transfer{
+		id:       id,
+		backend:  backend,
+		req:      req,
+		events:   events,
+		fullPath: filepath.Join(req.savePath, req.filename),
+	}
+	t.partPath = t.fullPath + partialSuffix
+	defer func() {
+		if t.file != nil {
+			t.file.Close()
+		}
+	}()
+
+	err := t.run(ctx, pause)
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	if err == nil {
+		err = finishDownload(ctx, t.file, t.partPath, t.fullPath, t.downloaded, t.total)
+		t.file = nil
+	}
+	if err == nil && t.segments != nil {
+		os.Remove(t.segmentStatePath()) //nolint:errcheck
+	}
+	if err != nil {
+		var progress float64
+		if t.total > 0 {
+			progress = t.progress()
+		}
+		events <- downloadStatusUpdate{id: id, progress: progress, complete: true, error: err, downloaded: t.downloaded, total: t.total, retries: t.retries}
+		return
+	}
+
+	events <- downloadStatusUpdate{
+		id:         id,
+		progress:   1.0,
+		complete:   true,
+		filePath:   t.fullPath,
+		error:      nil,
+		downloaded: t.downloaded,
+		total:      t.total,
+		retries:    t.retries,
+	}
+}
+
+// run makes download attempts until one succeeds, a non-retryable error occurs or the retries are used up
+func (t *transfer) run(ctx context.Context, pause <-chan bool) error {
+	if err := os.MkdirAll(t.req.savePath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	for {
+		if err := waitWhilePaused(ctx, pause); err != nil {
+			return err
+		}
+		err := t.backend.attempt(ctx, t, pause)
+		if err == nil || ctx.Err() != nil || t.retries >= conf.DownloadRetries || !retryableDownloadError(err) {
+			return err
+		}
+
+		t.retries++
+		t.report(err)
+		if err := sleepContext(ctx, downloadRetryDelay(t.retries)); err != nil {
+			return err
+		}
+		if linkExpired(err) && t.req.resolve != nil {
+			stream, resolveErr := t.req.resolve(ctx)
+			if resolveErr != nil {
+				return fmt.Errorf("%v; could not refresh the stream link: %v", err, resolveErr)
+			}
+			t.req.stream = stream
+		}
+	}
+}
+
+/*
+waitWhilePaused holds a transfer that was paused before an attempt, e.g. because the
+download window closed while its link was being resolved, so no connection is opened
+until it is resumed.
+*/
+func waitWhilePaused(ctx context.Context, pause <-chan bool) error {
+	select {
+	case paused := <-pause:
+		for paused {
+			select {
+			case paused = <-pause:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	default:
+	}
+	return nil
+}
+
+/*
+attempt transfers the stream from the bytes already saved on. The first attempt
+checks the free space and creates the .part file, switching to a segmented download
+when canSegment allows it; later ones continue it with a range request, or start over
+when the server answers with the whole file. A resumed download reopens the .part
+file of the earlier session instead and continues it the same way.
+*/
+func (t *transfer) attempt(ctx context.Context, pause <-chan bool) error {
+	if t.file == nil && t.req.resume {
+		t.req.resume = false
+		if err := t.reopenPartial(); err != nil {
+			return err
+		}
+	}
+	if t.segments != nil {
+		err := t.attemptSegments(ctx, pause)
+		if !errors.Is(err, errRangeIgnored) {
+			return err
+		}
+		if err := t.abandonSegments(); err != nil {
+			return err
+		}
+	}
+	resp, err := openStream(ctx, t.req.stream, t.downloaded)
+	var statusErr *downloadStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusRequestedRangeNotSatisfiable && t.downloaded > 0 {
+		// the earlier session saved every byte but stopped before the file was renamed
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { resp.Body.Close() }()
+
+	if t.file == nil {
+		t.total = resp.ContentLength
+		if err := checkFreeSpace(t.req.savePath, t.total); err != nil {
+			return err
+		}
+		// the file keeps its .part suffix until it has been verified, so the library and
+		// playback never pick up a truncated download
+		if t.file, err = os.Create(t.partPath); err != nil {
+			return fmt.Errorf("failed to create file: %v", err)
+		}
+		if t.canSegment(resp) {
+			resp.Body.Close()
+			if err := preallocate(t.file, t.total); err != nil {
+				return fmt.Errorf("failed to allocate file: %v", err)
+			}
+			t.segments = splitSegments(t.total, conf.DownloadConnections)
+			if err := t.saveSegments(); err != nil {
+				return err
+			}
+			return t.attempt(ctx, pause)
+		}
+	}
+	if err := t.restartIfWhole(resp); err != nil {
+		return err
+	}
+	if t.total <= 0 && resp.ContentLength >= 0 {
+		// a reopened .part file learns the full size from the first response
+		t.total = t.downloaded + resp.ContentLength
+	}
+
+	// reads run in the background so pause and cancel interrupt a stalled connection at once
+	type readResult struct {
+		n   int
+		err error
+	}
+	buf := make([]byte, 32*1024)
+	reads := make(chan readResult)
+	readNext := func() {
+		body := resp.Body
+		go func() {
+			n, err := body.Read(buf)
+			reads <- readResult{n, err}
+		}()
+	}
+	// write keeps the bytes of a read, even one interrupted by pause
+	write := func(r readResult) error {
+		if r.n == 0 {
+			return nil
+		}
+		if _, err := t.file.Write(buf[:r.n]); err != nil {
+			return fmt.Errorf("failed to write to file: %v", err)
+		}
+		t.downloaded += int64(r.n)
+		return nil
+	}
+
+	readNext()
+	for {
+		var r readResult
+		select {
+		case <-ctx.Done():
+			resp.Body.Close()
+			<-reads
+			return ctx.Err()
+		case paused := <-pause:
+			if !paused {
+				continue
+			}
+			// an idle connection would run into the read timeout, so it is dropped while paused
+			resp.Body.Close()
+			if err := write(<-reads); err != nil {
+				return err
+			}
+			for paused {
+				select {
+				case paused = <-pause:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			resp, err = openStream(ctx, t.req.stream, t.downloaded)
+			if err != nil {
+				resp = &http.Response{Body: http.NoBody}
+				return err
+			}
+			if err := t.restartIfWhole(resp); err != nil {
+				return err
+			}
+			readNext()
+			continue
+		case r = <-reads:
+		}
+
+		if err := write(r); err != nil {
+			return err
+		}
+		if r.n > 0 && time.Since(t.lastUpdate) > 100*time.Millisecond {
+			t.report(nil)
+			t.lastUpdate = time.Now()
+		}
+
+		if r.err == io.EOF {
+			if t.total > 0 && t.downloaded < t.total {
+				return errConnectionClosed
+			}
+			return nil
+		}
+		if r.err != nil {
+			return &transferError{op: "error reading response", err: r.err}
+		}
+		readNext()
+	}
+}
+
+/*
+reopenPartial opens the .part file of an interrupted download without truncating it.
+A segmented download continues each segment from its saved state; any other file is
+continued after its last byte. Without a .part file the download starts over.
+*/
+func (t *transfer) reopenPartial() error {
+	file, err := os.OpenFile(t.partPath, os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	if t.loadSegments() {
+		t.file = file
+		t.downloaded = t.segmentedBytes()
+		return nil
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	t.file, t.downloaded = file, size
+	return nil
+}
+
+// restartIfWhole empties the .part file when a ranged request was answered with the whole file
+func (t *transfer) restartIfWhole(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK || t.downloaded == 0 {
+		return nil
+	}
+	_, err := t.file.Seek(0, io.SeekStart)
+	if err == nil {
+		err = t.file.Truncate(0)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restart download: %v", err)
+	}
+	t.downloaded = 0
+	return nil
+}
@@ -0,0 +1,286 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+gatedServer serves a 64 KiB body in two halves; the second half is only sent once
+release is closed, so tests can act on a transfer that is known to be in progress.
+*/
+func gatedServer(t *testing.T) (server *httptest.Server, started, release chan struct{}) {
+	started, release = make(chan struct{}, 1), make(chan struct{})
+	body := make([]byte, 64*1024)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body[:len(body)/2]) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		select {
+		case <-release:
+			w.Write(body[len(body)/2:]) //nolint:errcheck
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, started, release
+}
+
+// waitComplete returns the final status update of download id
+func waitComplete(t *testing.T, e *downloadEngine, id int) downloadStatusUpdate {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update := <-e.Events():
+			if update.id == id && update.complete {
+				return update
+			}
+		case <-timeout:
+			t.Fatalf("download %d did not finish", id)
+		}
+	}
+}
+
+func testDownloadEngine(t *testing.T) *downloadEngine {
+	defaultConf, defaultClient := conf, apiClient
+	conf.VerifyDownloads = false
+	conf.DownloadRetries, conf.DownloadRetryDelay = 3, time.Millisecond
+	conf.DownloadConnections = 1
+	// a generous read timeout keeps the stalled test servers from failing transfers on a busy machine
+	apiClient = newHTTPClient(Config{NetworkConnectTimeout: time.Second, NetworkReadTimeout: 5 * time.Second})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		conf, apiClient = defaultConf, defaultClient
+	})
+	return newDownloadEngine(ctx, downloadWindow{}, builtinBackend{})
+}
+
+func TestDownloadEnginePauseResume(t *testing.T) {
+	e := testDownloadEngine(t)
+	server, started, release := gatedServer(t)
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	<-started
+	e.Pause(id)
+	e.Resume(id)
+	close(release)
+
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, filepath.Join(dir, "ep.mp4"), update.filePath)
+	info, err := os.Stat(update.filePath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 64*1024, info.Size())
+}
+
+func TestDownloadEngineCancel(t *testing.T) {
+	e := testDownloadEngine(t)
+	server, started, _ := gatedServer(t)
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	<-started
+	e.Pause(id)
+	e.Cancel(id)
+
+	update := waitComplete(t, e, id)
+	assert.ErrorIs(t, update.error, errDownloadCancelled)
+	assert.NoFileExists(t, filepath.Join(dir, "ep.mp4"))
+}
+
+func TestDownloadEngineSupersede(t *testing.T) {
+	e := testDownloadEngine(t)
+	server, started, release := gatedServer(t)
+	dir := t.TempDir()
+
+	first := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "1.mp4"})
+	<-started
+	second := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "2.mp4"})
+
+	assert.ErrorIs(t, waitComplete(t, e, first).error, errDownloadSuperseded)
+	<-started
+	close(release)
+	assert.NoError(t, waitComplete(t, e, second).error)
+}
+
+func TestCoalesceUpdates(t *testing.T) {
+	events := make(chan downloadStatusUpdate, 10)
+	events <- downloadStatusUpdate{id: 1, progress: 0.3}
+	events <- downloadStatusUpdate{id: 1, progress: 0.4}
+	events <- downloadStatusUpdate{id: 1, progress: 1, complete: true, filePath: "ep.mp4"}
+	events <- downloadStatusUpdate{id: 2, progress: 0.1}
+
+	updates := coalesceUpdates(downloadStatusUpdate{id: 1, progress: 0.2}, events)
+	assert.Equal(t, []downloadStatusUpdate{
+		{id: 1, progress: 1, complete: true, filePath: "ep.mp4"},
+		{id: 2, progress: 0.1},
+	}, updates, "progress collapses into the latest update and completions are never dropped")
+	assert.Empty(t, events)
+}
+
+func TestDownloadEnginePauseDropsStalledConnection(t *testing.T) {
+	e := testDownloadEngine(t)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	started, dropped := make(chan struct{}, 1), make(chan struct{}, 1)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first transfer stalls halfway, later ones (ranged or not) are served in full
+		if requests.Add(1) > 1 {
+			http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body[:len(body)/2]) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+		dropped <- struct{}{}
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	<-started
+	e.Pause(id)
+	<-dropped
+	e.Resume(id)
+
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data, "a resumed transfer continues with a range request or starts over")
+}
+
+func TestDownloadEngineRetriesTransientFailures(t *testing.T) {
+	e := testDownloadEngine(t)
+	body := bytes.Repeat([]byte("kaizen"), 10000)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			// announce the whole body but close the connection halfway
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body[:len(body)/2]) //nolint:errcheck
+		default:
+			http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+		}
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, 2, update.retries)
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+}
+
+func TestDownloadEngineRefreshesExpiredLink(t *testing.T) {
+	e := testDownloadEngine(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/expired" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("episode")) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	var resolved atomic.Int32
+	id := e.Start(downloadRequest{
+		stream:   StreamDescriptor{URL: server.URL + "/expired"},
+		savePath: t.TempDir(),
+		filename: "ep.mp4",
+		resolve: func(ctx context.Context) (StreamDescriptor, error) {
+			resolved.Add(1)
+			return StreamDescriptor{URL: server.URL + "/fresh"}, nil
+		},
+	})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.EqualValues(t, 1, resolved.Load())
+	assert.Equal(t, 1, update.retries)
+}
+
+func TestDownloadEngineDoesNotRetryPermanentFailures(t *testing.T) {
+	e := testDownloadEngine(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: t.TempDir(), filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.ErrorContains(t, update.error, "404")
+	assert.Equal(t, 0, update.retries)
+	assert.EqualValues(t, 1, requests.Load())
+}
+
+func TestDownloadRetryDelay(t *testing.T) {
+	defaultConf := conf
+	defer func() { conf = defaultConf }()
+	conf.DownloadRetryDelay = 5 * time.Second
+
+	assert.Equal(t, 5*time.Second, downloadRetryDelay(1))
+	assert.Equal(t, 10*time.Second, downloadRetryDelay(2))
+	assert.Equal(t, 20*time.Second, downloadRetryDelay(3))
+	assert.Equal(t, maxDownloadRetryDelay, downloadRetryDelay(20))
+}
+
+func TestDownloadEngineResumesPartialFile(t *testing.T) {
+	e := testDownloadEngine(t)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 4*1024)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ep.mp4"+partialSuffix), body[:1000], 0644))
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4", resume: true})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, []string{"bytes=1000-"}, ranges, "only the missing bytes are fetched")
+	assert.Equal(t, int64(len(body)), update.total)
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+}
+
+func TestDownloadEngineOwnsRetries(t *testing.T) {
+	e := testDownloadEngine(t)
+	conf.DownloadRetries = 2
+	apiClient = newHTTPClient(Config{NetworkConnectTimeout: time.Second, NetworkReadTimeout: 5 * time.Second, NetworkMaxRetries: 3, NetworkRetryDelay: time.Millisecond})
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: t.TempDir(), filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.Error(t, update.error)
+	assert.Equal(t, 2, update.retries)
+	assert.EqualValues(t, 3, calls.Load(), "every attempt sends one request; the shared client does not retry downloads")
+}
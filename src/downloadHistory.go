@@ -0,0 +1,259 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// download job states
+const (
+	jobQueued      = "queued"
+	jobDownloading = "downloading"
+	jobCompleted   = "completed"
+	jobFailed      = "failed"
+	jobCancelled   = "cancelled"
+)
+
+// maxFinishedDownloads bounds how many finished jobs the download history keeps
+const maxFinishedDownloads = 200
+
+/*
+downloadRecord is one download job. Source is the stream URL the job was last
+started from; it is kept for reference only, as stream links expire and a resumed
+job resolves a fresh one.
+*/
+type downloadRecord struct {
+	Key        string    `json:"key"`
+	Source     string    `json:"source,omitempty"`
+	AnimeName  string    `json:"animeName"`
+	AnimeID    string    `json:"animeId"`
+	Episode    string    `json:"episode"`
+	Type       string    `json:"type"`
+	Path       string    `json:"path,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	TotalBytes int64     `json:"totalBytes,omitempty"`
+	Retries    int       `json:"retries,omitempty"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	QueuedAt   time.Time `json:"queuedAt"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// Ref returns the episode the job downloads
+func (r downloadRecord) Ref() EpisodeRef {
+	ref, err := ParseEpisodeRef(r.Episode, r.Type)
+	if err != nil {
+		return EpisodeRef{ID: r.Episode, Type: r.Type}
+	}
+	return ref
+}
+
+// Finished reports whether the job has run to an end, successfully or not
+func (r downloadRecord) Finished() bool {
+	return r.Status == jobCompleted || r.Status == jobFailed || r.Status == jobCancelled
+}
+
+/*
+DownloadHistory is the download queue together with the record of finished jobs,
+persisted as JSON under ~/.local/share/kaizen/ so a queue interrupted by quitting
+can be resumed on the next start.
+*/
+type DownloadHistory struct {
+	Jobs []downloadRecord `json:"jobs"`
+
+	path string
+}
+
+// downloadHistoryPath returns the location of the persisted download history file
+func downloadHistoryPath() string {
+	return ExpandPath("~/.local/share/kaizen/downloads.json")
+}
+
+/*
+LoadDownloadHistory reads the download history stored at path. A missing or corrupt
+file yields an empty history.
+*/
+func LoadDownloadHistory(path string) *DownloadHistory {
+	h := &DownloadHistory{path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, h)
+	}
+	return h
+}
+
+// Save writes the history back to disk, creating the parent directory if needed
+func (h *DownloadHistory) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
+
+// Enqueue adds a job for the episode to the end of the queue and returns its key
+func (h *DownloadHistory) Enqueue(animeName, animeID string, ref EpisodeRef) string {
+	now := time.Now()
+	key := fmt.Sprintf("%d-%d", now.UnixNano(), len(h.Jobs))
+	h.Jobs = append(h.Jobs, downloadRecord{
+		Key:       key,
+		AnimeName: animeName,
+		AnimeID:   animeID,
+		Episode:   ref.ID,
+		Type:      ref.Type,
+		Status:    jobQueued,
+		QueuedAt:  now,
+	})
+	return key
+}
+
+// Get returns the job with the given key
+func (h *DownloadHistory) Get(key string) (*downloadRecord, bool) {
+	for i := range h.Jobs {
+		if h.Jobs[i].Key == key {
+			return &h.Jobs[i], true
+		}
+	}
+	return nil, false
+}
+
+// NextQueued returns the oldest job waiting to be started
+func (h *DownloadHistory) NextQueued() (*downloadRecord, bool) {
+	for i := range h.Jobs {
+		if h.Jobs[i].Status == jobQueued {
+			return &h.Jobs[i], true
+		}
+	}
+	return nil, false
+}
+
+// Queued returns the number of jobs waiting to be started
+func (h *DownloadHistory) Queued() int {
+	n := 0
+	for _, r := range h.Jobs {
+		if r.Status == jobQueued {
+			n++
+		}
+	}
+	return n
+}
+
+// Pending returns the jobs that have not finished: queued ones and ones interrupted mid-transfer
+func (h *DownloadHistory) Pending() []downloadRecord {
+	var pending []downloadRecord
+	for _, r := range h.Jobs {
+		if !r.Finished() {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
+
+/*
+Restore requeues the pending jobs left over from the previous session when resume is
+set, and cancels them otherwise. An interrupted transfer keeps its Path so it can
+continue its .part file.
+*/
+func (h *DownloadHistory) Restore(resume bool) {
+	for i := range h.Jobs {
+		r := &h.Jobs[i]
+		if r.Finished() {
+			continue
+		}
+		if resume {
+			r.Status, r.StartedAt = jobQueued, time.Time{}
+			continue
+		}
+		r.Status, r.Error, r.FinishedAt = jobCancelled, "not resumed after restart", time.Now()
+	}
+	h.trim()
+}
+
+// Start marks a job as downloading from source to path
+func (h *DownloadHistory) Start(key, source, path string) {
+	if r, ok := h.Get(key); ok {
+		r.Status, r.Source, r.Path, r.StartedAt, r.Error = jobDownloading, source, path, time.Now(), ""
+	}
+}
+
+// Finish records the outcome of a job; err is nil for a completed download
+func (h *DownloadHistory) Finish(key string, bytes, total int64, err error) {
+	r, ok := h.Get(key)
+	if !ok {
+		return
+	}
+	r.Bytes, r.TotalBytes, r.FinishedAt = bytes, total, time.Now()
+	switch {
+	case err == nil:
+		r.Status, r.Error = jobCompleted, ""
+	case isDownloadCancellation(err):
+		r.Status, r.Error = jobCancelled, err.Error()
+	default:
+		r.Status, r.Error = jobFailed, err.Error()
+	}
+	h.trim()
+}
+
+// Finished returns the finished jobs, most recent first
+func (h *DownloadHistory) Finished() []downloadRecord {
+	var finished []downloadRecord
+	for _, r := range h.Jobs {
+		if r.Finished() {
+			finished = append(finished, r)
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.After(finished[j].FinishedAt)
+	})
+	return finished
+}
+
+// trim drops the oldest finished jobs beyond maxFinishedDownloads
+func (h *DownloadHistory) trim() {
+	finished := h.Finished()
+	if len(finished) <= maxFinishedDownloads {
+		return
+	}
+	cutoff := finished[maxFinishedDownloads-1].FinishedAt
+	jobs := h.Jobs[:0]
+	for _, r := range h.Jobs {
+		if !r.Finished() || !r.FinishedAt.Before(cutoff) {
+			jobs = append(jobs, r)
+		}
+	}
+	h.Jobs = jobs
+}
+
+// openContainingFolder opens the directory holding path in the desktop file manager
+func openContainingFolder(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", dir)
+	case "windows":
+		cmd = exec.Command("explorer", dir)
+	default:
+		cmd = exec.Command("xdg-open", dir)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait() //nolint:errcheck
+	return nil
+}
@@ -0,0 +1,98 @@
+package src
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadHistoryLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "downloads.json")
+	h := LoadDownloadHistory(path)
+
+	first := h.Enqueue("Frieren", "abc", EpisodeRef{ID: "1", Type: "sub"})
+	second := h.Enqueue("Frieren", "abc", EpisodeRef{ID: "2", Type: "dub"})
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, 2, h.Queued())
+
+	next, ok := h.NextQueued()
+	assert.True(t, ok)
+	assert.Equal(t, first, next.Key)
+
+	h.Start(first, "https://cdn.example/1.mp4", "/videos/Frieren - E001 [sub].mp4")
+	h.Finish(first, 1024, 1024, nil)
+	assert.NoError(t, h.Save())
+
+	loaded := LoadDownloadHistory(path)
+	finished := loaded.Finished()
+	assert.Len(t, finished, 1)
+	assert.Equal(t, jobCompleted, finished[0].Status)
+	assert.Equal(t, "https://cdn.example/1.mp4", finished[0].Source)
+	assert.EqualValues(t, 1024, finished[0].Bytes)
+	assert.False(t, finished[0].StartedAt.IsZero())
+
+	pending := loaded.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "2", pending[0].Episode)
+	assert.Equal(t, "dub", pending[0].Ref().Type)
+}
+
+func TestDownloadHistoryFinishStatus(t *testing.T) {
+	h := LoadDownloadHistory("")
+	failed := h.Enqueue("A", "a", EpisodeRef{ID: "1", Type: "sub"})
+	cancelled := h.Enqueue("A", "a", EpisodeRef{ID: "2", Type: "sub"})
+
+	h.Finish(failed, 10, 20, errors.New("incomplete download"))
+	h.Finish(cancelled, 5, 20, errDownloadCancelled)
+
+	r, _ := h.Get(failed)
+	assert.Equal(t, jobFailed, r.Status)
+	assert.Equal(t, "incomplete download", r.Error)
+	r, _ = h.Get(cancelled)
+	assert.Equal(t, jobCancelled, r.Status)
+}
+
+func TestDownloadHistoryRestore(t *testing.T) {
+	h := LoadDownloadHistory("")
+	interrupted := h.Enqueue("A", "a", EpisodeRef{ID: "1", Type: "sub"})
+	h.Start(interrupted, "https://cdn.example/1.mp4", "/videos/a.mp4")
+	h.Enqueue("A", "a", EpisodeRef{ID: "2", Type: "sub"})
+
+	h.Restore(true)
+	assert.Equal(t, 2, h.Queued(), "interrupted transfers are queued again")
+	r, _ := h.Get(interrupted)
+	assert.Equal(t, "/videos/a.mp4", r.Path, "the path is kept so the .part file is continued")
+
+	h.Restore(false)
+	assert.Empty(t, h.Pending())
+	assert.Len(t, h.Finished(), 2)
+}
+
+func TestDownloadHistoryTrim(t *testing.T) {
+	h := LoadDownloadHistory("")
+	for i := 0; i < maxFinishedDownloads+10; i++ {
+		key := h.Enqueue("A", "a", EpisodeRef{ID: "1", Type: "sub"})
+		r, _ := h.Get(key)
+		r.Status, r.FinishedAt = jobCompleted, time.Now().Add(time.Duration(i)*time.Second)
+	}
+	queued := h.Enqueue("A", "a", EpisodeRef{ID: "2", Type: "sub"})
+	h.trim()
+
+	assert.Len(t, h.Finished(), maxFinishedDownloads)
+	_, ok := h.Get(queued)
+	assert.True(t, ok, "queued jobs are never trimmed")
+}
+
+func TestQueueDownloadWhileBusy(t *testing.T) {
+	m := NewMainModel()
+	m.tab1.watched = LoadWatchHistory("")
+	m.downloadM.isDownloading = true
+
+	cmd := m.queueDownload(EpisodeRef{ID: "3", Type: "sub"})
+	assert.Nil(t, cmd, "nothing starts while another download is running")
+	assert.Equal(t, 1, m.downloadM.history.Queued())
+	assert.Contains(t, m.downloadM.downloadStatus, "Queued Episode 3")
+}
@@ -0,0 +1,146 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// errDownloadCancelled is the error of a download the user cancelled
+var errDownloadCancelled = errors.New("download cancelled by user")
+
+// hookTimeout bounds how long a download hook may run
+const hookTimeout = 2 * time.Minute
+
+// downloadJob describes the episode a download is saving
+type downloadJob struct {
+	animeName string
+	animeID   string
+	ref       EpisodeRef
+	path      string
+}
+
+// downloadEvent is a finished download, successful when err is nil
+type downloadEvent struct {
+	job downloadJob
+	err error
+}
+
+// downloadHookMsg reports problems running the hook or sending the notification
+type downloadHookMsg struct {
+	err error
+}
+
+/*
+env returns the variables a hook command is run with:
+
+	KAIZEN_EVENT          complete or failed
+	KAIZEN_FILE           path of the downloaded file
+	KAIZEN_ANIME          anime name
+	KAIZEN_ANIME_ID       anime ID
+	KAIZEN_EPISODE        episode ID
+	KAIZEN_EPISODE_TYPE   sub or dub
+	KAIZEN_ERROR          why the download failed, empty on success
+*/
+func (e downloadEvent) env() []string {
+	event, errText := "complete", ""
+	if e.err != nil {
+		event, errText = "failed", e.err.Error()
+	}
+	return []string{
+		"KAIZEN_EVENT=" + event,
+		"KAIZEN_FILE=" + e.job.path,
+		"KAIZEN_ANIME=" + e.job.animeName,
+		"KAIZEN_ANIME_ID=" + e.job.animeID,
+		"KAIZEN_EPISODE=" + e.job.ref.ID,
+		"KAIZEN_EPISODE_TYPE=" + e.job.ref.Type,
+		"KAIZEN_ERROR=" + errText,
+	}
+}
+
+// hookCommand returns the configured hook for the event, if any
+func (e downloadEvent) hookCommand() string {
+	if e.err != nil {
+		return conf.HooksOnDownloadFailed
+	}
+	return conf.HooksOnDownloadComplete
+}
+
+/*
+runDownloadHook runs command through the shell with the event's environment variables
+added. Its output is discarded, except that stderr is included in the returned error
+when the command fails.
+*/
+func runDownloadHook(ctx context.Context, command string, e downloadEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), e.env()...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("hook %q: %v: %s", command, err, msg)
+		}
+		return fmt.Errorf("hook %q: %v", command, err)
+	}
+	return nil
+}
+
+// notificationText returns the summary and body of the desktop notification for the event
+func (e downloadEvent) notificationText() (string, string) {
+	episode := fmt.Sprintf("%s %s (%s)", e.job.animeName, e.job.ref.Label(), strings.ToUpper(e.job.ref.Type))
+	if e.err != nil {
+		return "Download failed", episode + "\n" + e.err.Error()
+	}
+	return "Download complete", episode
+}
+
+/*
+notifyDesktop shows a freedesktop notification by calling
+org.freedesktop.Notifications.Notify on the session bus with gdbus, falling back to
+notify-send when gdbus is not installed.
+*/
+func notifyDesktop(ctx context.Context, summary, body string) error {
+	if _, err := exec.LookPath("gdbus"); err == nil {
+		return exec.CommandContext(ctx, "gdbus", "call", "--session",
+			"--dest", "org.freedesktop.Notifications",
+			"--object-path", "/org/freedesktop/Notifications",
+			"--method", "org.freedesktop.Notifications.Notify",
+			"kaizen", "0", "", summary, body, "[]", "{}", "5000",
+		).Run()
+	}
+	if _, err := exec.LookPath("notify-send"); err == nil {
+		return exec.CommandContext(ctx, "notify-send", "--app-name=kaizen", summary, body).Run()
+	}
+	return fmt.Errorf("no notification service: install gdbus or notify-send")
+}
+
+// downloadEventCmd runs the configured hook and desktop notification for a finished download
+func downloadEventCmd(e downloadEvent) tea.Cmd {
+	command := e.hookCommand()
+	if command == "" && !conf.NotificationsDesktop {
+		return nil
+	}
+	return func() tea.Msg {
+		var errs []error
+		if command != "" {
+			errs = append(errs, runDownloadHook(appCtx, command, e))
+		}
+		if conf.NotificationsDesktop {
+			summary, body := e.notificationText()
+			if err := notifyDesktop(appCtx, summary, body); err != nil {
+				errs = append(errs, fmt.Errorf("notification: %w", err))
+			}
+		}
+		return downloadHookMsg{err: errors.Join(errs...)}
+	}
+}
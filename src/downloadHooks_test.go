@@ -0,0 +1,47 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDownloadHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.txt")
+	event := downloadEvent{job: downloadJob{
+		animeName: "Frieren",
+		animeID:   "abc",
+		ref:       EpisodeRef{ID: "5", Type: "dub"},
+		path:      "/videos/Frieren - E005 [dub].mp4",
+	}}
+
+	err := runDownloadHook(context.Background(), `echo "$KAIZEN_EVENT|$KAIZEN_FILE|$KAIZEN_ANIME|$KAIZEN_EPISODE|$KAIZEN_EPISODE_TYPE|$KAIZEN_ERROR" > `+out, event)
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(out)
+	assert.Equal(t, "complete|/videos/Frieren - E005 [dub].mp4|Frieren|5|dub|", strings.TrimSpace(string(data)))
+
+	event.err = errors.New("bad status: 403 Forbidden")
+	assert.NoError(t, runDownloadHook(context.Background(), `echo "$KAIZEN_EVENT|$KAIZEN_ERROR" > `+out, event))
+	data, _ = os.ReadFile(out)
+	assert.Equal(t, "failed|bad status: 403 Forbidden", strings.TrimSpace(string(data)))
+
+	err = runDownloadHook(context.Background(), "echo nope >&2; exit 3", event)
+	assert.ErrorContains(t, err, "nope", "a failing hook reports its stderr")
+}
+
+func TestDownloadEventCmdDisabled(t *testing.T) {
+	defaultConf := conf
+	defer func() { conf = defaultConf }()
+	conf.HooksOnDownloadComplete, conf.HooksOnDownloadFailed, conf.NotificationsDesktop = "", "", false
+
+	assert.Nil(t, downloadEventCmd(downloadEvent{}), "nothing runs when no hook or notification is configured")
+
+	summary, body := downloadEvent{job: downloadJob{animeName: "Frieren", ref: EpisodeRef{ID: "5", Type: "sub"}}}.notificationText()
+	assert.Equal(t, "Download complete", summary)
+	assert.Contains(t, body, "Frieren")
+}
@@ -0,0 +1,126 @@
+package src
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+libraryRoot returns the directory downloads are saved under: DownloadDir from config.yaml,
+or kaizen inside the XDG videos directory when it is not set. DownloadToWorkingDirectory
+overrides both with the working directory.
+*/
+func libraryRoot() string {
+	if conf.DownloadToWorkingDirectory {
+		wd, _ := os.Getwd()
+		return wd
+	}
+	if conf.DownloadDir != "" {
+		return ExpandPath(os.ExpandEnv(conf.DownloadDir))
+	}
+	return filepath.Join(xdgVideosDir(), "kaizen")
+}
+
+/*
+xdgVideosDir returns the user's videos directory: $XDG_VIDEOS_DIR, then the
+XDG_VIDEOS_DIR entry of ~/.config/user-dirs.dirs, and finally ~/Videos.
+*/
+func xdgVideosDir() string {
+	homeDIR, _ := os.UserHomeDir()
+	if dir := os.Getenv("XDG_VIDEOS_DIR"); dir != "" {
+		return ExpandPath(dir)
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = filepath.Join(homeDIR, ".config")
+	}
+	if f, err := os.Open(filepath.Join(configDir, "user-dirs.dirs")); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			name, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !ok || name != "XDG_VIDEOS_DIR" {
+				continue
+			}
+			value = strings.ReplaceAll(strings.Trim(value, `"`), "$HOME", homeDIR)
+			if value != "" && value != homeDIR {
+				return value
+			}
+		}
+	}
+	return filepath.Join(homeDIR, "Videos")
+}
+
+/*
+downloadTemplate returns the configured FilenameTemplate, or the media server layout
+when MediaServerLayout is on. An invalid template is reported as an error.
+*/
+func downloadTemplate() (filenameTemplate, error) {
+	raw := conf.FilenameTemplate
+	if conf.MediaServerLayout {
+		raw = mediaServerTemplate
+	} else if raw == "" {
+		raw = defaultFilenameTemplate
+	}
+	return parseFilenameTemplate(raw)
+}
+
+// episodeFilePath returns where an episode is saved according to the FilenameTemplate
+func episodeFilePath(animeName, animeID string, ref EpisodeRef) (string, error) {
+	tmpl, err := downloadTemplate()
+	if err != nil {
+		return "", err
+	}
+	rel := tmpl.Render(templateValues{Title: animeName, ID: animeID, Ref: ref, Ext: "mp4"})
+	return filepath.Join(libraryRoot(), filepath.FromSlash(rel)), nil
+}
+
+/*
+uniquePath returns path, or when a file already exists there, the first free
+"name (N).ext" next to it so an existing download is never overwritten.
+*/
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := base + " (" + strconv.Itoa(n) + ")" + ext
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// localEpisodePath returns the path of a completed download of the episode, if there is one
+func localEpisodePath(animeName, animeID string, ref EpisodeRef) (string, bool) {
+	candidates := []string{
+		// downloads made before FilenameTemplate existed
+		filepath.Join(libraryRoot(), animeName, legacyFileName(animeName, ref)),
+		filepath.Join(libraryRoot(), legacyFileName(animeName, ref)),
+	}
+	if path, err := episodeFilePath(animeName, animeID, ref); err == nil {
+		candidates = append([]string{path}, candidates...)
+	}
+
+	for _, path := range candidates {
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() && info.Size() > 0 {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// legacyFileName is the <animeName>_ep<ID>_<type>.mp4 name downloads used before FilenameTemplate
+func legacyFileName(animeName string, ref EpisodeRef) string {
+	filename := fmt.Sprintf("%s_ep%s_%s.mp4", animeName, ref.ID, ref.Type)
+	filename = strings.ReplaceAll(filename, " ", "_")
+	return strings.ReplaceAll(filename, ":", "")
+}
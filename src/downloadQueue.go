@@ -0,0 +1,230 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	gloss "github.com/charmbracelet/lipgloss"
+)
+
+// downloadResolvedMsg carries the stream link resolved for a queued download job
+type downloadResolvedMsg struct {
+	key    string
+	stream StreamDescriptor
+	err    error
+}
+
+// downloadRecordItem is a finished job in the download history list
+type downloadRecordItem struct {
+	record downloadRecord
+}
+
+func (i downloadRecordItem) Title() string {
+	icon := "✓"
+	switch i.record.Status {
+	case jobFailed:
+		icon = "✗"
+	case jobCancelled:
+		icon = "–"
+	}
+	return fmt.Sprintf("%s %s %s (%s)", icon, i.record.AnimeName, i.record.Ref().Label(), strings.ToUpper(i.record.Type))
+}
+
+func (i downloadRecordItem) Description() string {
+	when := i.record.FinishedAt.Format("2006-01-02 15:04")
+	if i.record.Status != jobCompleted {
+		return fmt.Sprintf("%s • %s • %s", i.record.Status, when, i.record.Error)
+	}
+	if i.record.Retries > 0 {
+		return fmt.Sprintf("%s • %s • %d retries", formatSize(i.record.Bytes), when, i.record.Retries)
+	}
+	return fmt.Sprintf("%s • %s", formatSize(i.record.Bytes), when)
+}
+
+func (i downloadRecordItem) FilterValue() string { return i.record.AnimeName }
+
+// refreshHistoryList shows the finished jobs of the download history
+func (m *MainModel) refreshHistoryList() {
+	var items []list.Item
+	for _, r := range m.downloadM.history.Finished() {
+		items = append(items, downloadRecordItem{record: r})
+	}
+	m.downloadM.historyList.SetItems(items)
+}
+
+// queueDownload adds the episode to the download queue, starting it right away when nothing is downloading
+func (m *MainModel) queueDownload(ref EpisodeRef) tea.Cmd {
+	// remember the title so the Library tab can match the files to the watch history
+	m.tab1.watched.SetTitle(m.tab1.animeID, m.tab1.animeName)
+	m.tab1.watched.Save() //nolint:errcheck
+
+	m.downloadM.history.Enqueue(m.tab1.animeName, m.tab1.animeID, ref)
+	m.downloadM.history.Save() //nolint:errcheck
+
+	if m.downloadM.isDownloading || m.downloadM.resolving || !m.downloadM.schedule.open {
+		m.downloadM.downloadStatus = fmt.Sprintf("Queued %s (%d waiting)", ref.Label(), m.downloadM.history.Queued())
+		return nil
+	}
+	return m.startNextDownload()
+}
+
+// continueQueue starts the next queued job, or hands control back to the download window once the queue is empty
+func (m *MainModel) continueQueue() tea.Cmd {
+	if m.downloadM.history.Queued() > 0 {
+		return m.startNextDownload()
+	}
+	if m.downloadM.schedule.override {
+		m.downloads.Override(false)
+	}
+	return nil
+}
+
+/*
+startNextDownload takes the oldest queued job and resolves its stream link in the
+background; the download itself starts when the downloadResolvedMsg arrives. Nothing
+is started while the download window is closed or the user has not yet answered
+whether to resume the jobs of the previous session.
+*/
+func (m *MainModel) startNextDownload() tea.Cmd {
+	if !m.downloadM.schedule.open || m.restorePrompt {
+		return nil
+	}
+	record, ok := m.downloadM.history.NextQueued()
+	if !ok {
+		return nil
+	}
+	record.Status = jobDownloading
+
+	m.resetDownloadState()
+	m.downloadM.jobKey = record.Key
+	m.downloadM.resolving = true
+	m.downloadM.selectedEpisode = record.Episode
+	m.downloadM.episodeType = record.Type
+	m.downloadM.downloadStatus = "Fetching stream link..."
+	m.DownloadFileName = fmt.Sprintf("%s %s", record.AnimeName, record.Ref().Label())
+
+	job := *record
+	return func() tea.Msg {
+		stream, err := resolveStream(appCtx, job.AnimeID, job.Type, job.Episode)
+		if err == nil && stream.URL == "" {
+			err = fmt.Errorf("could not fetch stream link")
+		}
+		return downloadResolvedMsg{key: job.Key, stream: stream, err: err}
+	}
+}
+
+// beginDownload hands a resolved job to the download engine
+func (m *MainModel) beginDownload(msg downloadResolvedMsg) tea.Cmd {
+	if msg.key != m.downloadM.jobKey {
+		return nil
+	}
+	m.downloadM.resolving = false
+	record, ok := m.downloadM.history.Get(msg.key)
+	if !ok || record.Status != jobDownloading {
+		// the job was cancelled or requeued while its stream link was resolved
+		m.resetDownloadState()
+		return m.startNextDownload()
+	}
+	ref := record.Ref()
+
+	path, err := episodeFilePath(record.AnimeName, record.AnimeID, ref)
+	if msg.err != nil {
+		err = msg.err
+		m.downloadM.streamLink = fmt.Sprintf("Error: %v", err)
+		m.downloadM.showStreamLink = true
+	}
+	if err != nil {
+		m.downloadM.history.Finish(record.Key, 0, 0, err)
+		m.downloadM.history.Save() //nolint:errcheck
+		m.refreshHistoryList()
+		m.downloadM.downloadStatus = "Error"
+		m.downloadM.downloadError = err.Error()
+		return m.continueQueue()
+	}
+
+	// an interrupted job continues its .part file; a new one must not overwrite an earlier download
+	resume := false
+	if record.Path != "" {
+		_, statErr := os.Stat(record.Path + partialSuffix)
+		resume = statErr == nil
+	}
+	if resume {
+		path = record.Path
+	} else {
+		path = uniquePath(path)
+	}
+	filename := filepath.Base(path)
+	m.DownloadFileName = filename
+	m.downloadM.streamLink = msg.stream.URL
+	m.downloadM.showStreamLink = true
+
+	m.downloadM.job = downloadJob{animeName: record.AnimeName, animeID: record.AnimeID, ref: ref, path: path}
+	m.downloadM.media = nil
+	if anime, ok := m.tab1.animeByID(record.AnimeID); ok && conf.MediaServerLayout {
+		rel, _ := filepath.Rel(libraryRoot(), path)
+		showDir, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		m.downloadM.media = &mediaInfo{anime: anime, ref: ref, showDir: filepath.Join(libraryRoot(), showDir), videoPath: path}
+	}
+
+	m.downloadM.history.Start(record.Key, msg.stream.URL, path)
+	m.downloadM.history.Save() //nolint:errcheck
+
+	m.downloadM.isRunning = true
+	m.downloadM.isDownloading = true
+	m.downloadM.percent = 0
+	m.downloadM.downloadStatus = "Downloading..."
+	m.downloadM.downloadError = ""
+	animeID, episodeType, episode := record.AnimeID, record.Type, record.Episode
+	m.downloadM.downloadID = m.downloads.Start(downloadRequest{
+		stream:   msg.stream,
+		savePath: filepath.Dir(path),
+		filename: filename,
+		resolve: func(ctx context.Context) (StreamDescriptor, error) {
+			return resolveStream(ctx, animeID, episodeType, episode)
+		},
+		resume: resume,
+	})
+	return nil
+}
+
+// answerRestorePrompt resumes or discards the jobs left over from the previous session
+func (m *MainModel) answerRestorePrompt(resume bool) tea.Cmd {
+	m.restorePrompt = false
+	m.downloadM.history.Restore(resume)
+	m.downloadM.history.Save() //nolint:errcheck
+	m.refreshHistoryList()
+	if !resume {
+		return nil
+	}
+	return m.startNextDownload()
+}
+
+// restorePromptView asks whether to resume the downloads that were pending when Kaizen was closed
+func (m MainModel) restorePromptView() string {
+	pending := m.downloadM.history.Pending()
+	lines := []string{
+		gloss.NewStyle().Bold(true).Foreground(gloss.Color("#B3BEFE")).Render("Unfinished downloads"),
+		"",
+		fmt.Sprintf("%d download(s) did not finish last time:", len(pending)),
+	}
+	for i, r := range pending {
+		if i == 5 {
+			lines = append(lines, fmt.Sprintf("  … and %d more", len(pending)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  • %s %s (%s)", r.AnimeName, r.Ref().Label(), strings.ToUpper(r.Type)))
+	}
+	lines = append(lines, "", "Resume them? (y/n)")
+
+	box := gloss.NewStyle().
+		Border(gloss.RoundedBorder()).
+		BorderForeground(gloss.Color(conf.defaultActiveTabDark)).
+		Padding(1, 3).
+		Render(strings.Join(lines, "\n"))
+	return gloss.Place(m.width, m.height, gloss.Center, gloss.Center, box)
+}
@@ -0,0 +1,120 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/*
+downloadWindow is the DownloadWindow setting: the time of day, in local time, during
+which queued downloads may transfer. A window whose end is before its start wraps
+past midnight ("22:00-06:00"). The zero value is always open.
+*/
+type downloadWindow struct {
+	start, end int // minutes after midnight
+	set        bool
+}
+
+// parseDownloadWindow parses a "HH:MM-HH:MM" window; an empty string means no restriction
+func parseDownloadWindow(s string) (downloadWindow, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return downloadWindow{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return downloadWindow{}, fmt.Errorf("download window %q must look like 01:00-07:00", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return downloadWindow{}, fmt.Errorf("download window %q: %v", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return downloadWindow{}, fmt.Errorf("download window %q: %v", s, err)
+	}
+	if start == end {
+		return downloadWindow{}, fmt.Errorf("download window %q starts and ends at the same time", s)
+	}
+	return downloadWindow{start: start, end: end, set: true}, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// Contains reports whether downloads may run at t
+func (w downloadWindow) Contains(t time.Time) bool {
+	if !w.set {
+		return true
+	}
+	now := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return now >= w.start && now < w.end
+	}
+	return now >= w.start || now < w.end
+}
+
+// NextBoundary returns the next time after t at which the window opens or closes
+func (w downloadWindow) NextBoundary(t time.Time) time.Time {
+	var next time.Time
+	for day := 0; day <= 1; day++ {
+		for _, minutes := range []int{w.start, w.end} {
+			b := time.Date(t.Year(), t.Month(), t.Day()+day, minutes/60, minutes%60, 0, 0, t.Location())
+			if b.After(t) && (next.IsZero() || b.Before(next)) {
+				next = b
+			}
+		}
+	}
+	return next
+}
+
+// configuredDownloadWindow returns the DownloadWindow from config.yaml, warning about and ignoring an invalid one
+func configuredDownloadWindow() downloadWindow {
+	w, err := parseDownloadWindow(conf.DownloadWindow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\033[0;33m [!] Ignoring DownloadWindow: %v \033[0m \n", err)
+	}
+	return w
+}
+
+/*
+downloadSchedule tells the UI whether queued downloads may run. open is false outside
+the download window unless the user started the queue explicitly (override); next is
+when the window opens or closes again.
+*/
+type downloadSchedule struct {
+	open     bool
+	override bool
+	next     time.Time
+}
+
+// downloadScheduleMsg reports a change of the download schedule
+type downloadScheduleMsg downloadSchedule
+
+// listenDownloadSchedule waits for the next schedule change; the Update handler re-arms it
+func listenDownloadSchedule(e *downloadEngine) tea.Cmd {
+	return func() tea.Msg {
+		return downloadScheduleMsg(<-e.schedule)
+	}
+}
+
+// waitingLabel describes when a closed schedule opens again
+func (s downloadSchedule) waitingLabel() string {
+	if s.next.IsZero() {
+		return "Waiting for download window"
+	}
+	return "Waiting for download window (opens " + s.next.Format("15:04") + ")"
+}
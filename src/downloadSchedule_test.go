@@ -0,0 +1,135 @@
+package src
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDownloadWindow(t *testing.T) {
+	w, err := parseDownloadWindow("01:00-07:30")
+	assert.NoError(t, err)
+	assert.Equal(t, downloadWindow{start: 60, end: 450, set: true}, w)
+
+	w, err = parseDownloadWindow("")
+	assert.NoError(t, err)
+	assert.False(t, w.set)
+
+	for _, bad := range []string{"01:00", "1-7", "25:00-07:00", "01:00-01:00", "01:60-02:00"} {
+		_, err := parseDownloadWindow(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestDownloadWindowContains(t *testing.T) {
+	at := func(hh, mm int) time.Time { return time.Date(2024, 3, 10, hh, mm, 0, 0, time.Local) }
+
+	night, _ := parseDownloadWindow("22:00-06:00")
+	assert.True(t, night.Contains(at(23, 0)))
+	assert.True(t, night.Contains(at(5, 59)))
+	assert.False(t, night.Contains(at(6, 0)))
+	assert.False(t, night.Contains(at(12, 0)))
+
+	early, _ := parseDownloadWindow("01:00-07:00")
+	assert.True(t, early.Contains(at(1, 0)))
+	assert.False(t, early.Contains(at(0, 59)))
+	assert.True(t, downloadWindow{}.Contains(at(12, 0)), "no window is always open")
+}
+
+func TestDownloadWindowNextBoundary(t *testing.T) {
+	at := func(day, hh, mm int) time.Time { return time.Date(2024, 3, day, hh, mm, 0, 0, time.Local) }
+	w, _ := parseDownloadWindow("01:00-07:00")
+
+	assert.Equal(t, at(11, 1, 0), w.NextBoundary(at(10, 12, 0)), "closed in the afternoon, opens after midnight")
+	assert.Equal(t, at(10, 7, 0), w.NextBoundary(at(10, 3, 0)), "open at night, closes in the morning")
+	assert.Equal(t, at(10, 7, 0), w.NextBoundary(at(10, 1, 0)))
+}
+
+func TestDownloadEngineWaitsForWindow(t *testing.T) {
+	defaultConf, defaultClient := conf, apiClient
+	conf.VerifyDownloads = false
+	apiClient = newTestHTTPClient(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conf, apiClient = defaultConf, defaultClient
+	}()
+
+	// a one minute window twelve hours from now is certainly closed
+	now := time.Now().Add(12 * time.Hour)
+	start := now.Hour()*60 + now.Minute()
+	window := downloadWindow{start: start, end: (start + 1) % (24 * 60), set: true}
+	e := newDownloadEngine(ctx, window, builtinBackend{})
+
+	schedule := <-e.schedule
+	assert.False(t, schedule.open)
+	assert.False(t, schedule.next.IsZero())
+
+	server, started, release := gatedServer(t)
+	dir := t.TempDir()
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	close(release)
+
+	select {
+	case <-started:
+		t.Fatal("no request may be sent while the window is closed")
+	case update := <-e.Events():
+		assert.False(t, update.complete, "the transfer must wait for the window")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	e.Override(true)
+	assert.True(t, (<-e.schedule).open)
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.FileExists(t, filepath.Join(dir, "ep.mp4"))
+}
+
+func TestDownloadScheduleWaitsForRestorePrompt(t *testing.T) {
+	m := NewMainModel()
+	m.currentScreen = AppScreen
+	m.downloadM.history = LoadDownloadHistory("")
+	key := m.downloadM.history.Enqueue("Frieren", "abc", EpisodeRef{ID: "1", Type: "sub"})
+	m.restorePrompt = true
+
+	model, _ := m.Update(downloadScheduleMsg{open: true})
+	m = model.(MainModel)
+	assert.False(t, m.downloadM.resolving, "the queue waits for the prompt to be answered")
+	record, _ := m.downloadM.history.Get(key)
+	assert.Equal(t, jobQueued, record.Status)
+
+	model, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	m = model.(MainModel)
+	assert.Nil(t, cmd)
+	assert.False(t, m.downloadM.resolving)
+	record, _ = m.downloadM.history.Get(key)
+	assert.Equal(t, jobCancelled, record.Status)
+
+	// a link resolved for a job that was cancelled in the meantime is dropped
+	m.downloadM.jobKey, m.downloadM.resolving = key, true
+	model, _ = m.Update(downloadResolvedMsg{key: key, stream: StreamDescriptor{URL: "https://cdn.example/1.mp4"}})
+	m = model.(MainModel)
+	assert.False(t, m.downloadM.isDownloading)
+	assert.False(t, m.downloadM.resolving)
+	record, _ = m.downloadM.history.Get(key)
+	assert.Equal(t, jobCancelled, record.Status)
+}
+
+func TestRestorePromptStartsQueue(t *testing.T) {
+	m := NewMainModel()
+	m.currentScreen = AppScreen
+	m.downloadM.history = LoadDownloadHistory("")
+	key := m.downloadM.history.Enqueue("Frieren", "abc", EpisodeRef{ID: "1", Type: "sub"})
+	m.downloadM.schedule.open = true
+	m.restorePrompt = true
+
+	model, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	m = model.(MainModel)
+	assert.NotNil(t, cmd, "resuming resolves the first job")
+	assert.True(t, m.downloadM.resolving)
+	assert.Equal(t, key, m.downloadM.jobKey)
+}
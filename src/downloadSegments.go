@@ -0,0 +1,274 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// minSegmentSize is the smallest byte range worth a connection of its own
+var minSegmentSize int64 = 4 << 20
+
+/*
+errRangeIgnored is returned when a server that announced range support sends the
+whole file anyway, as a CDN node behind the same URL may do. The download then goes
+on over a single connection.
+*/
+var errRangeIgnored = errors.New("the server ignored the range request")
+
+// segment is one byte range of a segmented download; done counts the bytes saved from start on
+type segment struct {
+	start, end int64 // inclusive
+	done       atomic.Int64
+	retries    int
+}
+
+// remaining returns the bytes of the segment that have not been saved yet
+func (s *segment) remaining() int64 {
+	return s.end - s.start + 1 - s.done.Load()
+}
+
+// segmentStateSuffix names the file next to a segmented .part that records how far each segment got
+const segmentStateSuffix = ".segments"
+
+/*
+segmentState is the saved progress of a segmented download. The .part file of one is
+preallocated, so its size says nothing about what has been written; a resumed
+download continues from the state instead.
+*/
+type segmentState struct {
+	Total    int64      `json:"total"`
+	Segments [][3]int64 `json:"segments"` // start, end and bytes done
+}
+
+func (t *transfer) segmentStatePath() string {
+	return t.partPath + segmentStateSuffix
+}
+
+// saveSegments records the progress of every segment
+func (t *transfer) saveSegments() error {
+	state := segmentState{Total: t.total}
+	for _, s := range t.segments {
+		state.Segments = append(state.Segments, [3]int64{s.start, s.end, s.done.Load()})
+	}
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = os.WriteFile(t.segmentStatePath(), data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save download progress: %v", err)
+	}
+	return nil
+}
+
+// loadSegments restores the segments saved by an earlier session, reporting whether there were any
+func (t *transfer) loadSegments() bool {
+	data, err := os.ReadFile(t.segmentStatePath())
+	if err != nil {
+		return false
+	}
+	var state segmentState
+	if json.Unmarshal(data, &state) != nil || state.Total <= 0 || len(state.Segments) == 0 {
+		return false
+	}
+	segments := make([]*segment, len(state.Segments))
+	for i, saved := range state.Segments {
+		s := &segment{start: saved[0], end: saved[1]}
+		s.done.Store(min(max(saved[2], 0), saved[1]-saved[0]+1))
+		segments[i] = s
+	}
+	t.total, t.segments = state.Total, segments
+	return true
+}
+
+// splitSegments divides total bytes into at most n ranges of at least minSegmentSize
+func splitSegments(total int64, n int) []*segment {
+	n = max(min(n, int(total/minSegmentSize)), 1)
+	size := total / int64(n)
+	segments := make([]*segment, n)
+	for i := range segments {
+		s := &segment{start: int64(i) * size, end: int64(i+1)*size - 1}
+		if i == n-1 {
+			s.end = total - 1
+		}
+		segments[i] = s
+	}
+	return segments
+}
+
+/*
+canSegment reports whether the download answered by resp is split into byte ranges:
+DownloadConnections asks for more than one connection, the server accepts ranges and
+the file is large enough for at least two segments.
+*/
+func (t *transfer) canSegment(resp *http.Response) bool {
+	return conf.DownloadConnections > 1 && resp.StatusCode == http.StatusOK &&
+		resp.Header.Get("Accept-Ranges") == "bytes" && t.total >= 2*minSegmentSize
+}
+
+/*
+abandonSegments switches a segmented download to a single connection. The bytes up to
+the first unfinished part of a segment are kept and the rest is fetched in order.
+*/
+func (t *transfer) abandonSegments() error {
+	var contiguous int64
+	for _, s := range t.segments {
+		contiguous += s.done.Load()
+		if s.remaining() > 0 {
+			break
+		}
+	}
+	t.segments = nil
+	os.Remove(t.segmentStatePath()) //nolint:errcheck
+	if err := t.file.Truncate(contiguous); err != nil {
+		return fmt.Errorf("failed to restart download: %v", err)
+	}
+	if _, err := t.file.Seek(contiguous, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to restart download: %v", err)
+	}
+	t.downloaded = contiguous
+	return nil
+}
+
+// segmentedBytes returns the bytes saved by all segments
+func (t *transfer) segmentedBytes() int64 {
+	var n int64
+	for _, s := range t.segments {
+		n += s.done.Load()
+	}
+	return n
+}
+
+/*
+attemptSegments fetches the unfinished segments concurrently, each over its own
+connection and written at its offset into the preallocated .part file. The first
+segment to fail stops the others; a pause stops all of them and they continue from
+where they were once resumed, as does the next attempt after a failure. Their
+progress is saved about once a second so a later session can continue them too.
+*/
+func (t *transfer) attemptSegments(ctx context.Context, pause <-chan bool) error {
+	for {
+		segCtx, stop := context.WithCancel(ctx)
+		errs := make(chan error, len(t.segments))
+		running := 0
+		for _, s := range t.segments {
+			if s.remaining() > 0 {
+				running++
+				go func() { errs <- t.fetchSegment(segCtx, s) }()
+			}
+		}
+
+		ticker := time.NewTicker(100 * time.Millisecond)
+		var err error
+		paused := false
+		for ticks := 1; running > 0 && err == nil && !paused; ticks++ {
+			select {
+			case err = <-errs:
+				running--
+			case paused = <-pause:
+			case <-ticker.C:
+				t.downloaded = t.segmentedBytes()
+				t.report(nil)
+				if ticks%10 == 0 {
+					t.saveSegments() //nolint:errcheck // the next save or the final one catches up
+				}
+			}
+		}
+		ticker.Stop()
+		stop()
+		for ; running > 0; running-- {
+			<-errs
+		}
+		t.downloaded = t.segmentedBytes()
+		t.saveSegments() //nolint:errcheck
+
+		if err != nil || !paused {
+			return err
+		}
+		for paused {
+			select {
+			case paused = <-pause:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+/*
+fetchSegment downloads the rest of s, retrying it on its own up to DownloadRetries
+times. An expired link is left to the engine, which resolves a fresh one for all
+segments.
+*/
+func (t *transfer) fetchSegment(ctx context.Context, s *segment) error {
+	for {
+		err := t.readSegment(ctx, s)
+		if err == nil || ctx.Err() != nil || linkExpired(err) || s.retries >= conf.DownloadRetries || !retryableDownloadError(err) {
+			return err
+		}
+		s.retries++
+		if err := sleepContext(ctx, downloadRetryDelay(s.retries)); err != nil {
+			return err
+		}
+	}
+}
+
+// readSegment requests the unsaved part of s and writes it at its offset
+func (t *transfer) readSegment(ctx context.Context, s *segment) error {
+	offset := s.start + s.done.Load()
+	resp, err := openRange(ctx, t.req.stream, offset, s.end)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 32*1024)
+	for offset <= s.end {
+		n, err := resp.Body.Read(buf[:min(int64(len(buf)), s.end-offset+1)])
+		if n > 0 {
+			if _, err := t.file.WriteAt(buf[:n], offset); err != nil {
+				return fmt.Errorf("failed to write to file: %v", err)
+			}
+			offset += int64(n)
+			s.done.Add(int64(n))
+		}
+		if err == io.EOF {
+			if offset <= s.end {
+				return errConnectionClosed
+			}
+			return nil
+		}
+		if err != nil {
+			return &transferError{op: "error reading response", err: err}
+		}
+	}
+	return nil
+}
+
+// openRange requests bytes start through end of the stream; only a partial answer is accepted
+func openRange(ctx context.Context, stream StreamDescriptor, start, end int64) (*http.Response, error) {
+	httpReq, err := stream.NewRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := apiClient.DoOnce(httpReq)
+	if err != nil {
+		return nil, &transferError{op: "failed to fetch URL", err: err}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil, errRangeIgnored
+		}
+		return nil, &downloadStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return resp, nil
+}
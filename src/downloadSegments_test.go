@@ -0,0 +1,221 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// segmentServer serves body with range support, letting fail answer a ranged request first
+func segmentServer(t *testing.T, body []byte, fail func(r *http.Request) bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail != nil && fail(r) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testSegmentedEngine(t *testing.T, connections int) *downloadEngine {
+	e := testDownloadEngine(t)
+	defaultSize := minSegmentSize
+	minSegmentSize = 16 * 1024
+	conf.DownloadConnections = connections
+	t.Cleanup(func() { minSegmentSize = defaultSize })
+	return e
+}
+
+func TestSplitSegments(t *testing.T) {
+	defaultSize := minSegmentSize
+	defer func() { minSegmentSize = defaultSize }()
+	minSegmentSize = 100
+
+	segments := splitSegments(1050, 4)
+	assert.Len(t, segments, 4)
+	var next int64
+	for _, s := range segments {
+		assert.Equal(t, next, s.start)
+		next = s.end + 1
+	}
+	assert.Equal(t, int64(1050), next)
+
+	assert.Len(t, splitSegments(250, 8), 2)
+	assert.Len(t, splitSegments(50, 8), 1)
+}
+
+func TestDownloadEngineSegmented(t *testing.T) {
+	e := testSegmentedEngine(t, 4)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 8*1024)
+	var ranges atomic.Int32
+	server := segmentServer(t, body, func(r *http.Request) bool {
+		if r.Header.Get("Range") != "" {
+			ranges.Add(1)
+		}
+		return false
+	})
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.EqualValues(t, 4, ranges.Load())
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+}
+
+func TestDownloadEngineSegmentRetry(t *testing.T) {
+	e := testSegmentedEngine(t, 4)
+	body := bytes.Repeat([]byte("kaizen"), 20*1024)
+	// the first request for the last segment fails; only that segment is fetched again
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := segmentServer(t, body, func(r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		rng := r.Header.Get("Range")
+		requests[rng]++
+		return strings.HasSuffix(rng, "-"+strconv.Itoa(len(body)-1)) && requests[rng] == 1
+	})
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, 0, update.retries)
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+
+	mu.Lock()
+	defer mu.Unlock()
+	retried := 0
+	for rng, n := range requests {
+		if rng != "" && n > 1 {
+			retried++
+		}
+	}
+	assert.Equal(t, 1, retried)
+}
+
+func TestDownloadEngineSegmentedNeedsRangeSupport(t *testing.T) {
+	e := testSegmentedEngine(t, 4)
+	body := bytes.Repeat([]byte("kaizen"), 20*1024)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(body) //nolint:errcheck
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	assert.NoError(t, waitComplete(t, e, id).error)
+	assert.EqualValues(t, 1, requests.Load())
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+}
+
+func TestDownloadEngineSegmentedPauseResume(t *testing.T) {
+	e := testSegmentedEngine(t, 2)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 4*1024)
+	half := len(body) / 2
+	started, dropped := make(chan struct{}, 1), make(chan struct{}, 1)
+	var stalled atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first segment stalls halfway the first time, everything else is served in full
+		if !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") || stalled.Swap(true) {
+			http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", half-1, len(body)))
+		w.Header().Set("Content-Length", strconv.Itoa(half))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[:half/2]) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+		dropped <- struct{}{}
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	<-started
+	e.Pause(id)
+	<-dropped
+	e.Resume(id)
+
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+}
+
+func TestDownloadEngineResumesSegments(t *testing.T) {
+	e := testSegmentedEngine(t, 2)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 8*1024)
+	var mu sync.Mutex
+	var ranges []string
+	server := segmentServer(t, body, func(r *http.Request) bool {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		return false
+	})
+	dir := t.TempDir()
+
+	// the first segment is done and the second got 100 bytes into the preallocated file
+	half := int64(len(body) / 2)
+	part := make([]byte, len(body))
+	copy(part, body[:half+100])
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ep.mp4"+partialSuffix), part, 0644))
+	state := fmt.Sprintf(`{"total":%d,"segments":[[0,%d,%d],[%d,%d,100]]}`, len(body), half-1, half, half, len(body)-1)
+	statePath := filepath.Join(dir, "ep.mp4"+partialSuffix+segmentStateSuffix)
+	assert.NoError(t, os.WriteFile(statePath, []byte(state), 0644))
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4", resume: true})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%d-%d", half+100, len(body)-1)}, ranges, "finished segments are not fetched again")
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data)
+	assert.NoFileExists(t, statePath, "the saved progress is removed with the finished download")
+}
+
+func TestDownloadEngineFallsBackWhenRangeIgnored(t *testing.T) {
+	e := testSegmentedEngine(t, 2)
+	body := bytes.Repeat([]byte("0123456789abcdef"), 8*1024)
+	var ignored atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// one node behind the URL ignores the range of the second segment
+		if strings.HasPrefix(r.Header.Get("Range"), fmt.Sprintf("bytes=%d-", len(body)/2)) && ignored.CompareAndSwap(false, true) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body) //nolint:errcheck
+			return
+		}
+		http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	id := e.Start(downloadRequest{stream: StreamDescriptor{URL: server.URL}, savePath: dir, filename: "ep.mp4"})
+	update := waitComplete(t, e, id)
+	assert.NoError(t, update.error)
+	assert.True(t, ignored.Load())
+	data, _ := os.ReadFile(filepath.Join(dir, "ep.mp4"))
+	assert.Equal(t, body, data, "the download continues over one connection")
+	assert.NoFileExists(t, filepath.Join(dir, "ep.mp4"+partialSuffix+segmentStateSuffix))
+}
@@ -0,0 +1,142 @@
+package src
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// partialSuffix is appended to a download's file name until it has been verified
+const partialSuffix = ".part"
+
+// freeSpaceMargin is kept free on top of the download size so the disk is never filled completely
+const freeSpaceMargin = 64 << 20
+
+var errFreeSpaceUnsupported = errors.New("free space check not supported on this platform")
+
+/*
+checkFreeSpace fails when the filesystem holding dir cannot fit need more bytes plus
+freeSpaceMargin. An unknown size (need <= 0) or a platform without a free-space query
+passes the check.
+*/
+func checkFreeSpace(dir string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	free, err := freeSpace(dir)
+	if errors.Is(err, errFreeSpaceUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not check free space: %v", err)
+	}
+	if free < uint64(need)+freeSpaceMargin {
+		return fmt.Errorf("not enough disk space: need %s, %s free", formatSize(need), formatSize(int64(free)))
+	}
+	return nil
+}
+
+// verifyDownloadSize fails when fewer (or more) bytes arrived than the server announced
+func verifyDownloadSize(got, want int64) error {
+	if want > 0 && got != want {
+		return fmt.Errorf("incomplete download: received %s of %s", formatSize(got), formatSize(want))
+	}
+	return nil
+}
+
+/*
+verifyContainer checks that a finished download is a playable video. ffprobe is used
+when it is installed; otherwise MP4 files are checked for a moov atom, without which
+no player can open them. Files in other containers pass when ffprobe is missing.
+*/
+func verifyContainer(ctx context.Context, path string) error {
+	if _, err := exec.LookPath("ffprobe"); err == nil {
+		out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", path).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("ffprobe rejected the file: %s", strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return verifyMP4(path)
+}
+
+/*
+verifyMP4 walks the top-level boxes of an MP4 file. It fails when the boxes run past
+the end of the file (a truncated download) or when there is no moov box. Files that do
+not start with an ftyp box are not MP4 and are not checked.
+*/
+func verifyMP4(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	hasMoov := false
+	header := make([]byte, 16)
+	for offset < info.Size() {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return fmt.Errorf("truncated mp4: box header at %d: %v", offset, err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		if offset == 0 && boxType != "ftyp" {
+			return nil
+		}
+
+		switch size {
+		case 0:
+			size = info.Size() - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil && err != io.EOF {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > info.Size() {
+			return fmt.Errorf("truncated mp4: %q box runs past the end of the file", boxType)
+		}
+		hasMoov = hasMoov || boxType == "moov"
+		offset += size
+	}
+	if !hasMoov {
+		return fmt.Errorf("invalid mp4: no moov atom")
+	}
+	return nil
+}
+
+/*
+finishDownload closes the partial file, checks that every announced byte arrived and,
+when VerifyDownloads is on, that the container is intact, and then moves it to its final
+path. A file that fails verification is left behind with its .part suffix. file is nil
+when an external backend wrote the download.
+*/
+func finishDownload(ctx context.Context, file *os.File, partPath, fullPath string, downloaded, totalSize int64) error {
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write to file: %v", err)
+		}
+	}
+	if err := verifyDownloadSize(downloaded, totalSize); err != nil {
+		return err
+	}
+	if conf.VerifyDownloads {
+		if err := verifyContainer(ctx, partPath); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(partPath, fullPath); err != nil {
+		return fmt.Errorf("failed to move finished download: %v", err)
+	}
+	return nil
+}
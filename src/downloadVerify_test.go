@@ -0,0 +1,80 @@
+package src
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mp4Box builds a top-level box with the given type and payload size
+func mp4Box(boxType string, payload int) []byte {
+	box := make([]byte, 8+payload)
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	copy(box[4:], boxType)
+	return box
+}
+
+func writeTestFile(t *testing.T, data ...[]byte) string {
+	path := filepath.Join(t.TempDir(), "episode.mp4.part")
+	var all []byte
+	for _, d := range data {
+		all = append(all, d...)
+	}
+	assert.NoError(t, os.WriteFile(path, all, 0644))
+	return path
+}
+
+func TestVerifyMP4(t *testing.T) {
+	complete := writeTestFile(t, mp4Box("ftyp", 16), mp4Box("moov", 64), mp4Box("mdat", 256))
+	assert.NoError(t, verifyMP4(complete))
+
+	truncated := writeTestFile(t, mp4Box("ftyp", 16), mp4Box("moov", 64), mp4Box("mdat", 256)[:100])
+	assert.ErrorContains(t, verifyMP4(truncated), "truncated")
+
+	noMoov := writeTestFile(t, mp4Box("ftyp", 16), mp4Box("mdat", 256))
+	assert.ErrorContains(t, verifyMP4(noMoov), "moov")
+
+	notMP4 := writeTestFile(t, []byte("\x1aE\xdf\xa3 matroska data"))
+	assert.NoError(t, verifyMP4(notMP4), "other containers are not checked")
+}
+
+func TestVerifyDownloadSize(t *testing.T) {
+	assert.NoError(t, verifyDownloadSize(1024, 1024))
+	assert.NoError(t, verifyDownloadSize(1024, -1), "unknown length cannot be verified")
+	assert.ErrorContains(t, verifyDownloadSize(512, 1024), "incomplete download")
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, checkFreeSpace(dir, 0))
+	assert.NoError(t, checkFreeSpace(dir, 1024))
+	if _, err := freeSpace(dir); err == nil {
+		assert.ErrorContains(t, checkFreeSpace(dir, math.MaxInt64/2), "not enough disk space")
+	}
+}
+
+func TestFinishDownload(t *testing.T) {
+	defaultConf := conf
+	defer func() { conf = defaultConf }()
+	conf.VerifyDownloads = false
+
+	dir := t.TempDir()
+	final := filepath.Join(dir, "episode.mp4")
+	part := final + partialSuffix
+
+	f, _ := os.Create(part)
+	f.Write(make([]byte, 10)) //nolint:errcheck
+	assert.ErrorContains(t, finishDownload(context.Background(), f, part, final, 10, 20), "incomplete")
+	assert.NoFileExists(t, final)
+	assert.FileExists(t, part, "a truncated download keeps its .part suffix")
+
+	f, _ = os.OpenFile(part, os.O_WRONLY, 0644)
+	assert.NoError(t, finishDownload(context.Background(), f, part, final, 10, 10))
+	assert.FileExists(t, final)
+	assert.NoFileExists(t, part)
+}
@@ -0,0 +1,161 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ytDlpProgressPrefix marks the progress lines yt-dlp prints with the template from ytDlpArgs
+const ytDlpProgressPrefix = "kaizen-progress"
+
+/*
+ytDlpBackend runs yt-dlp for every download, which also handles HLS playlists. yt-dlp
+has no pause: it is stopped when the transfer pauses and continues its own .part file
+when started again.
+*/
+type ytDlpBackend struct {
+	path string
+}
+
+/*
+ytDlpArgs returns the yt-dlp command line that saves t's stream to t.partPath with
+its headers and the configured proxy, printing only machine-readable progress lines.
+*/
+func ytDlpArgs(c Config, t *transfer) []string {
+	args := []string{
+		"--quiet", "--progress", "--newline", "--no-playlist", "--no-mtime", "--continue",
+		"--progress-template", "download:" + ytDlpProgressPrefix +
+			" %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s",
+		// -o is an output template, so a literal % has to be doubled
+		"-o", strings.ReplaceAll(t.partPath, "%", "%%"),
+	}
+	names := make([]string, 0, len(t.req.stream.Headers))
+	for name := range t.req.stream.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--add-header", name+":"+t.req.stream.Headers.Get(name))
+	}
+	if c.NetworkProxy != "" {
+		args = append(args, "--proxy", c.NetworkProxy)
+	}
+	return append(args, "--", t.req.stream.URL)
+}
+
+// parseYtDlpProgress reads a progress line; total falls back to yt-dlp's estimate and is 0 when unknown
+func parseYtDlpProgress(line string) (downloaded, total int64, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != ytDlpProgressPrefix {
+		return 0, 0, false
+	}
+	done, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, field := range fields[2:] {
+		if size, err := strconv.ParseFloat(field, 64); err == nil {
+			total = int64(size)
+			break
+		}
+	}
+	return int64(done), total, true
+}
+
+// ytDlpHTTPError finds the status of a rejected request in yt-dlp's error output
+var ytDlpHTTPError = regexp.MustCompile(`HTTP Error (\d{3}): ([^(\n]*)`)
+
+// ytDlpError describes a failed yt-dlp run, keeping rejected requests recognizable for retries
+func ytDlpError(stderr string, err error) error {
+	if m := ytDlpHTTPError.FindStringSubmatch(stderr); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return &downloadStatusError{code: code, status: m[1] + " " + strings.TrimSpace(m[2])}
+	}
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Errorf("yt-dlp: %s", last)
+	}
+	return fmt.Errorf("yt-dlp: %v", err)
+}
+
+func (b ytDlpBackend) attempt(ctx context.Context, t *transfer, pause <-chan bool) error {
+	for {
+		runCtx, stop := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- b.run(runCtx, t) }()
+
+		paused := false
+		for !paused {
+			select {
+			case err := <-done:
+				stop()
+				return err
+			case paused = <-pause:
+			}
+		}
+		stop()
+		<-done
+		for paused {
+			select {
+			case paused = <-pause:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// run downloads with one yt-dlp process, mapping its progress lines onto t
+func (b ytDlpBackend) run(ctx context.Context, t *transfer) error {
+	cmd := exec.CommandContext(ctx, b.path, ytDlpArgs(conf, t)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("%s not found: install yt-dlp or set Downloader.YtDlpPath", b.path)
+		}
+		return fmt.Errorf("failed to start yt-dlp: %v", err)
+	}
+
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() {
+		downloaded, total, ok := parseYtDlpProgress(lines.Text())
+		if !ok {
+			continue
+		}
+		t.downloaded, t.total = downloaded, total
+		if time.Since(t.lastUpdate) > 100*time.Millisecond {
+			t.report(nil)
+			t.lastUpdate = time.Now()
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return ytDlpError(stderr.String(), err)
+	}
+	info, err := os.Stat(t.partPath)
+	if err != nil {
+		return fmt.Errorf("yt-dlp did not save the download: %v", err)
+	}
+	// yt-dlp checks the transfer itself and often only knows an estimated size, so the file counts
+	t.downloaded, t.total = info.Size(), info.Size()
+	return nil
+}
@@ -0,0 +1,82 @@
+package src
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+EpisodeRef identifies a single episode the way the API does, together with the
+values derived from it that the UI needs. It is shared by the streaming and the
+download paths so both agree on which episode was selected.
+
+  - ID is the episode identifier exactly as the API lists it ("12", "12.5", "SP1", "1000")
+    and is what gets sent back to the API when requesting a stream link.
+  - Type is the episode type, "sub" or "dub".
+  - Number is the numeric value of the episode used for jumps and range filters.
+    For specials it is the trailing number ("SP1" -> 1).
+  - Special is set for IDs that are not plain numbers, such as "SP1" or "OVA2".
+*/
+type EpisodeRef struct {
+	ID      string
+	Type    string
+	Number  float64
+	Special bool
+}
+
+/*
+ParseEpisodeRef builds an EpisodeRef from an API episode ID and type.
+It returns an error for empty IDs or IDs containing whitespace or path separators,
+which cannot be requested from the API.
+*/
+func ParseEpisodeRef(id, episodeType string) (EpisodeRef, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return EpisodeRef{}, fmt.Errorf("empty episode id")
+	}
+	if strings.ContainsAny(id, "/\\") || strings.IndexFunc(id, unicode.IsSpace) >= 0 {
+		return EpisodeRef{}, fmt.Errorf("invalid episode id %q", id)
+	}
+
+	ref := EpisodeRef{ID: id, Type: episodeType}
+	if n, err := strconv.ParseFloat(id, 64); err == nil {
+		ref.Number = n
+		return ref, nil
+	}
+
+	ref.Special = true
+	digits := strings.TrimLeftFunc(id, func(r rune) bool { return !unicode.IsDigit(r) })
+	if n, err := strconv.ParseFloat(digits, 64); err == nil {
+		ref.Number = n
+	}
+	return ref, nil
+}
+
+// Label returns the human readable name of the episode, e.g. "Episode 12.5"
+func (e EpisodeRef) Label() string {
+	return "Episode " + e.ID
+}
+
+/*
+Matches reports whether user input refers to this episode. Numeric input is
+compared by value so "7", "07" and "7.0" all match episode 7; anything else
+is compared case-insensitively against the ID ("sp1" matches "SP1").
+*/
+func (e EpisodeRef) Matches(input string) bool {
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, e.ID) {
+		return true
+	}
+	if e.Special {
+		return false
+	}
+	n, err := strconv.ParseFloat(input, 64)
+	return err == nil && n == e.Number
+}
+
+// String returns the API episode ID
+func (e EpisodeRef) String() string {
+	return e.ID
+}
@@ -0,0 +1,192 @@
+package src
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// episodeRange limits an episode list to episodes numbered from..to (inclusive)
+type episodeRange struct {
+	from   float64
+	to     float64
+	active bool
+}
+
+/*
+episodeJump is the parsed content of the jump prompt opened from the Sub/Dub lists.
+It either names an episode to move the cursor to, or a range to filter the list by.
+A zero value clears any active range.
+*/
+type episodeJump struct {
+	episode string
+	rng     episodeRange
+}
+
+/*
+parseEpisodeJump parses jump prompt input such as "712", ":712", "100-200" or ":100-200".
+An empty input (or a lone ":") clears the range filter.
+*/
+func parseEpisodeJump(input string) (episodeJump, error) {
+	input = strings.TrimPrefix(strings.TrimSpace(input), ":")
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return episodeJump{}, nil
+	}
+
+	if from, to, ok := strings.Cut(input, "-"); ok && from != "" {
+		lo, errLo := strconv.ParseFloat(strings.TrimSpace(from), 64)
+		hi, errHi := strconv.ParseFloat(strings.TrimSpace(to), 64)
+		if errLo != nil || errHi != nil {
+			return episodeJump{}, fmt.Errorf("invalid episode range %q", input)
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		return episodeJump{rng: episodeRange{from: lo, to: hi, active: true}}, nil
+	}
+	return episodeJump{episode: input}, nil
+}
+
+// contains reports whether an episode falls inside the range; specials never do
+func (r episodeRange) contains(ref EpisodeRef) bool {
+	if !r.active {
+		return true
+	}
+	return !ref.Special && ref.Number >= r.from && ref.Number <= r.to
+}
+
+func (r episodeRange) String() string {
+	if !r.active {
+		return ""
+	}
+	return fmt.Sprintf("[%s-%s]", strconv.FormatFloat(r.from, 'f', -1, 64), strconv.FormatFloat(r.to, 'f', -1, 64))
+}
+
+/*
+episodeItems builds the list items for the given episodes, applying the range
+filter and marking episodes found in the watch history. Episode IDs that cannot
+be requested from the API are left out.
+*/
+func (m *Tab1Model) episodeItems(episodes []string, episodeType string, rng episodeRange) []list.Item {
+	items := []list.Item{}
+	for _, episode := range episodes {
+		ref, err := ParseEpisodeRef(episode, episodeType)
+		if err != nil || !rng.contains(ref) {
+			continue
+		}
+		items = append(items, item{
+			title:   ref.Label() + "               ",
+			style:   "default",
+			ref:     ref,
+			watched: m.watched.IsWatched(m.animeID, episodeType, ref.ID),
+		})
+	}
+	return items
+}
+
+// openJumpPrompt opens the jump prompt for the focused episode list, pre-filled with initial
+func (m *Tab1Model) openJumpPrompt(initial string) tea.Cmd {
+	m.jumpTarget = m.focus
+	m.focus = jumpFocus
+	m.jumpErr = ""
+	m.jumpM.SetValue(initial)
+	m.jumpM.CursorEnd()
+	return m.jumpM.Focus()
+}
+
+/*
+updateJumpPrompt handles key presses while the jump prompt is open.
+Enter applies the jump or range filter, esc closes the prompt without changes.
+*/
+func (m Tab1Model) updateJumpPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		jump, err := parseEpisodeJump(m.jumpM.Value())
+		if err != nil {
+			m.jumpErr = err.Error()
+			return m, nil
+		}
+		m.closeJumpPrompt()
+		m.applyEpisodeJump(jump)
+		return m, nil
+	case "esc":
+		m.closeJumpPrompt()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.jumpM, cmd = m.jumpM.Update(msg)
+	m.jumpErr = ""
+	return m, cmd
+}
+
+func (m *Tab1Model) closeJumpPrompt() {
+	m.focus = m.jumpTarget
+	m.jumpM.Blur()
+	m.jumpM.SetValue("")
+}
+
+/*
+applyEpisodeJump moves the cursor of the targeted list to the requested episode,
+or rebuilds the list with the requested range filter.
+*/
+func (m *Tab1Model) applyEpisodeJump(jump episodeJump) {
+	episodeList := &m.listOne
+	if m.jumpTarget == listTwoFocus {
+		episodeList = &m.listTwo
+	}
+
+	if jump.episode == "" {
+		if m.jumpTarget == listTwoFocus {
+			m.dubRange = jump.rng
+			m.listTwo.SetItems(m.generateDubEpisodes())
+			m.listTwo.Title = strings.TrimSpace("Dub " + m.dubRange.String())
+		} else {
+			m.subRange = jump.rng
+			m.listOne.SetItems(m.generateSubEpisodes())
+			m.listOne.Title = strings.TrimSpace("Sub " + m.subRange.String())
+		}
+		episodeList.Select(0)
+		return
+	}
+
+	for idx, listItem := range episodeList.Items() {
+		if i, ok := listItem.(item); ok && i.ref.Matches(jump.episode) {
+			episodeList.Select(idx)
+			return
+		}
+	}
+	m.jumpErr = fmt.Sprintf("episode %s not found", jump.episode)
+}
+
+/*
+markEpisodeWatched records a played episode in the watch history and refreshes
+its marker in the list it was played from.
+*/
+func (m *Tab1Model) markEpisodeWatched(episodeList *list.Model, ref EpisodeRef) {
+	m.watched.MarkWatched(m.animeID, ref.Type, ref.ID)
+	m.watched.SetTitle(m.animeID, m.animeName)
+	m.watched.Save() //nolint:errcheck
+
+	if i, ok := episodeList.SelectedItem().(item); ok && i.ref == ref {
+		i.watched = true
+		episodeList.SetItem(episodeList.Index(), i)
+	}
+}
+
+// jumpPromptView renders the jump prompt (or its last error) in place of the help hint
+func (m Tab1Model) jumpPromptView() string {
+	if m.jumpM.Focused() {
+		hint := lipgloss.NewStyle().Foreground(lipgloss.Color("239")).Render("  (episode, or range like 100-200; empty clears)")
+		return "\n  " + m.jumpM.View() + hint
+	}
+	if m.jumpErr != "" {
+		return "\n  " + lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render(m.jumpErr)
+	}
+	return ""
+}
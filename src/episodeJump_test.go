@@ -0,0 +1,53 @@
+package src
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEpisodeJump(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected episodeJump
+		wantErr  bool
+	}{
+		{name: "Plain number", input: "712", expected: episodeJump{episode: "712"}},
+		{name: "Colon prefix", input: ":712", expected: episodeJump{episode: "712"}},
+		{name: "Fractional episode", input: "12.5", expected: episodeJump{episode: "12.5"}},
+		{name: "Range", input: ":100-200", expected: episodeJump{rng: episodeRange{from: 100, to: 200, active: true}}},
+		{name: "Reversed range", input: "200 - 100", expected: episodeJump{rng: episodeRange{from: 100, to: 200, active: true}}},
+		{name: "Empty clears", input: ":", expected: episodeJump{}},
+		{name: "Bad range", input: "1-x", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jump, err := parseEpisodeJump(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, jump)
+		})
+	}
+}
+
+func TestEpisodeItemsRangeAndWatched(t *testing.T) {
+	m := Tab1Model{
+		animeID: "abc",
+		watched: LoadWatchHistory(filepath.Join(t.TempDir(), "watched.json")),
+	}
+	m.watched.MarkWatched("abc", "sub", "3")
+
+	items := m.episodeItems([]string{"1", "2", "3", "4", "SP1"}, "sub", episodeRange{from: 2, to: 3, active: true})
+	assert.Len(t, items, 2)
+	assert.Equal(t, "2", items[0].(item).ref.ID)
+	assert.False(t, items[0].(item).watched)
+	assert.True(t, items[1].(item).watched)
+
+	assert.Len(t, m.episodeItems([]string{"1", "SP1"}, "dub", episodeRange{}), 2, "no range keeps every episode")
+}
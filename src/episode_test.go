@@ -0,0 +1,81 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEpisodeRef(t *testing.T) {
+	testCases := []struct {
+		name     string
+		id       string
+		expected EpisodeRef
+		wantErr  bool
+	}{
+		{name: "Single digit", id: "7", expected: EpisodeRef{ID: "7", Type: "sub", Number: 7}},
+		{name: "Four digits", id: "1071", expected: EpisodeRef{ID: "1071", Type: "sub", Number: 1071}},
+		{name: "Fractional", id: "12.5", expected: EpisodeRef{ID: "12.5", Type: "sub", Number: 12.5}},
+		{name: "Leading zeros kept in ID", id: "007", expected: EpisodeRef{ID: "007", Type: "sub", Number: 7}},
+		{name: "Surrounding spaces", id: " 3 ", expected: EpisodeRef{ID: "3", Type: "sub", Number: 3}},
+		{name: "Special", id: "SP1", expected: EpisodeRef{ID: "SP1", Type: "sub", Number: 1, Special: true}},
+		{name: "OVA without number", id: "OVA", expected: EpisodeRef{ID: "OVA", Type: "sub", Special: true}},
+		{name: "Empty", id: "  ", wantErr: true},
+		{name: "Path separator", id: "1/2", wantErr: true},
+		{name: "Inner whitespace", id: "Episode 1", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := ParseEpisodeRef(tc.id, "sub")
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ref)
+		})
+	}
+}
+
+func TestEpisodeRefMatches(t *testing.T) {
+	testCases := []struct {
+		id       string
+		input    string
+		expected bool
+	}{
+		{id: "7", input: "7", expected: true},
+		{id: "7", input: "07", expected: true},
+		{id: "7", input: "7.0", expected: true},
+		{id: "12.5", input: "12.5", expected: true},
+		{id: "12.5", input: "12", expected: false},
+		{id: "SP1", input: "sp1", expected: true},
+		{id: "SP1", input: "1", expected: false},
+		{id: "1000", input: "100", expected: false},
+	}
+
+	for _, tc := range testCases {
+		ref, err := ParseEpisodeRef(tc.id, "dub")
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, ref.Matches(tc.input), "episode %q matching %q", tc.id, tc.input)
+	}
+}
+
+func TestSelectedEpisodeFromList(t *testing.T) {
+	m := NewTab1Model()
+	m.availableSubEpisodes = []string{"1", "12.5", "SP1", "1000"}
+	m.listOne.SetItems(m.generateSubEpisodes())
+
+	m.listOne.Select(3)
+	ref, ok := selectedEpisode(m.listOne)
+	assert.True(t, ok)
+	assert.Equal(t, "1000", ref.ID, "four-digit episodes must not be truncated")
+
+	m.listOne.Select(1)
+	ref, _ = selectedEpisode(m.listOne)
+	assert.Equal(t, "12.5", ref.ID)
+	assert.Equal(t, "Episode 12.5", ref.Label())
+
+	_, ok = selectedEpisode(NewTab1Model().listOne)
+	assert.False(t, ok, "the placeholder item is not an episode")
+}
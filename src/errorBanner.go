@@ -0,0 +1,87 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+/*
+ErrorBanner is a one line notice shown between the search input and the results
+table when a request fails. It distinguishes an empty search ("no results") from
+the API being unreachable ("service unavailable"), and tells the user whether the
+failed request can be retried.
+*/
+type ErrorBanner struct {
+	title     string
+	detail    string
+	severe    bool
+	retryable bool
+	visible   bool
+}
+
+// searchErrorMsg is returned by fetchAnimeData when a page of search results could not be fetched
+type searchErrorMsg struct {
+	query string
+	page  int
+	err   *APIError
+}
+
+/*
+newErrorBanner builds the banner for a failed API request. subject describes
+what was being requested (a search query or an episode) and is woven into the
+message; retryable controls whether the retry hint is shown.
+*/
+func newErrorBanner(subject string, err error, retryable bool) ErrorBanner {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return ErrorBanner{title: "Something went wrong", detail: err.Error(), severe: true, retryable: retryable, visible: true}
+	}
+
+	banner := ErrorBanner{severe: apiErr.Unavailable(), retryable: retryable, visible: true}
+	switch {
+	case errors.Is(err, errOffline):
+		banner.title = "Offline"
+		banner.detail = fmt.Sprintf("%s is not cached or downloaded", subject)
+		banner.severe = false
+		banner.retryable = false
+	case apiErr.Kind == ErrEmptyResult && apiErr.Op == "search":
+		banner.title = fmt.Sprintf("No results for %q", subject)
+		banner.detail = "try a different spelling or the english title"
+		banner.retryable = false
+	case apiErr.Kind == ErrEmptyResult:
+		banner.title = fmt.Sprintf("No %s available for %s", apiErr.Op, subject)
+		banner.detail = "the episode may not be released yet"
+	case apiErr.Unavailable():
+		banner.title = "Service unavailable"
+		banner.detail = apiErr.Error()
+	default:
+		banner.title = fmt.Sprintf("Request for %s failed", subject)
+		banner.detail = apiErr.Error()
+	}
+	return banner
+}
+
+// View renders the banner, or an empty string when it is hidden
+func (b ErrorBanner) View() string {
+	if !b.visible {
+		return ""
+	}
+
+	color := lipgloss.Color(conf.Tab1SpinnerMsgColor)
+	icon := "ⓘ "
+	if b.severe {
+		color = lipgloss.Color("#FF0000")
+		icon = "✗ "
+	}
+	titleStyle := lipgloss.NewStyle().Foreground(color).Bold(true)
+	detailStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("242"))
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("246"))
+
+	line := titleStyle.Render(icon+b.title) + detailStyle.Render(" — "+b.detail)
+	if b.retryable {
+		line += hintStyle.Render("  • ctrl+r retry")
+	}
+	return lipgloss.NewStyle().PaddingLeft(2).Render(line)
+}
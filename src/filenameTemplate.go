@@ -0,0 +1,281 @@
+package src
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultFilenameTemplate is used when FilenameTemplate is not set in config.yaml
+const defaultFilenameTemplate = "{title}/{title} - E{ep:03} [{lang}].{ext}"
+
+/*
+mediaServerTemplate is used instead of FilenameTemplate when MediaServerLayout is on.
+It follows the Show/Season/SxxEyy layout Jellyfin, Plex and Kodi match automatically.
+*/
+const mediaServerTemplate = "{title}/Season 01/{title} - S01E{ep:02}{dub}.{ext}"
+
+// maxSegmentLength keeps every path segment well inside the 255 byte limit of common filesystems
+const maxSegmentLength = 200
+
+/*
+filenameTemplate is a parsed FilenameTemplate. "/" separates directories, and these
+placeholders are substituted (each value sanitized for use in a file name):
+
+	{title}   anime name
+	{id}      anime ID
+	{ep}      episode ID, {ep:03} zero-pads the episode number to 3 digits
+	{lang}    sub or dub
+	{dub}     " [dub]" for dubbed episodes, nothing for subbed ones
+	{ext}     file extension without the dot
+*/
+type filenameTemplate struct {
+	raw      string
+	segments [][]templatePart
+}
+
+// templatePart is either literal text or a placeholder with an optional width
+type templatePart struct {
+	literal string
+	field   string
+	width   int
+}
+
+// templateValues are the values substituted into a filenameTemplate
+type templateValues struct {
+	Title string
+	ID    string
+	Ref   EpisodeRef
+	Ext   string
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+var templateFields = map[string]bool{"title": true, "id": true, "ep": true, "lang": true, "dub": true, "ext": true}
+
+/*
+parseFilenameTemplate validates a FilenameTemplate. Unknown placeholders, empty
+segments and "." or ".." segments are rejected, and the file name (last segment)
+must contain {ep} so episodes never overwrite each other.
+*/
+func parseFilenameTemplate(raw string) (filenameTemplate, error) {
+	t := filenameTemplate{raw: raw}
+	raw = strings.Trim(strings.ReplaceAll(raw, "\\", "/"), "/")
+	if raw == "" {
+		return t, fmt.Errorf("filename template is empty")
+	}
+
+	for _, segment := range strings.Split(raw, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return t, fmt.Errorf("filename template %q has an invalid path segment %q", t.raw, segment)
+		}
+
+		var parts []templatePart
+		last := 0
+		for _, loc := range templatePlaceholder.FindAllStringSubmatchIndex(segment, -1) {
+			if loc[0] > last {
+				parts = append(parts, templatePart{literal: segment[last:loc[0]]})
+			}
+			field := segment[loc[2]:loc[3]]
+			if !templateFields[field] {
+				return t, fmt.Errorf("filename template %q has an unknown placeholder {%s}", t.raw, field)
+			}
+			part := templatePart{field: field}
+			if loc[4] >= 0 {
+				part.width, _ = strconv.Atoi(segment[loc[4]:loc[5]])
+			}
+			parts = append(parts, part)
+			last = loc[1]
+		}
+		if last < len(segment) {
+			parts = append(parts, templatePart{literal: segment[last:]})
+		}
+		t.segments = append(t.segments, parts)
+	}
+
+	hasEpisode := false
+	for _, part := range t.segments[len(t.segments)-1] {
+		hasEpisode = hasEpisode || part.field == "ep"
+	}
+	if !hasEpisode {
+		return t, fmt.Errorf("filename template %q must contain {ep} in the file name", t.raw)
+	}
+	return t, nil
+}
+
+// Render expands the template into a relative path using "/" as separator
+func (t filenameTemplate) Render(v templateValues) string {
+	segments := make([]string, len(t.segments))
+	for i, parts := range t.segments {
+		var b strings.Builder
+		for _, part := range parts {
+			if part.field == "" || part.field == "dub" {
+				b.WriteString(part.literal + v.field(part))
+				continue
+			}
+			b.WriteString(sanitizeFileName(v.field(part)))
+		}
+		segments[i] = sanitizeFileName(b.String())
+	}
+	return strings.Join(segments, "/")
+}
+
+func (v templateValues) field(part templatePart) string {
+	switch part.field {
+	case "title":
+		return v.Title
+	case "id":
+		return v.ID
+	case "ep":
+		return padEpisode(v.Ref.ID, part.width)
+	case "lang":
+		return v.Ref.Type
+	case "dub":
+		if v.Ref.Type == "dub" {
+			return " [dub]"
+		}
+		return ""
+	case "ext":
+		return v.Ext
+	}
+	return ""
+}
+
+// padEpisode zero-pads the integer part of a numeric episode ID ("7" -> "007", "7.5" -> "007.5")
+func padEpisode(id string, width int) string {
+	whole, frac, _ := strings.Cut(id, ".")
+	if width <= 0 || !isDigits(whole) {
+		return id
+	}
+	if len(whole) < width {
+		whole = strings.Repeat("0", width-len(whole)) + whole
+	}
+	if frac != "" {
+		return whole + "." + frac
+	}
+	return whole
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// videoExtensions are the file extensions Pattern accepts for {ext}
+const videoExtensions = `(?i:mp4|mkv|webm|m4v)`
+
+/*
+Pattern returns a regexp matching the relative paths (with "/" separators) this
+template renders, with named groups title, id, ep, lang and dub for the first occurrence
+of each placeholder. An optional " (N)" collision suffix before the extension is
+accepted as well. Only video extensions match, so the .nfo files and the .part and
+.segments files of unfinished downloads next to an episode are not taken for one, and
+{ep} does not extend past a "." unless a fractional episode number follows.
+*/
+func (t filenameTemplate) Pattern() *regexp.Regexp {
+	seen := make(map[string]bool)
+	segments := make([]string, len(t.segments))
+	for i, parts := range t.segments {
+		var b strings.Builder
+		for n, part := range parts {
+			if part.field == "" {
+				literal := part.literal
+				// the collision suffix is inserted before the final ".{ext}"
+				if i == len(t.segments)-1 && n == len(parts)-2 && parts[n+1].field == "ext" && strings.HasSuffix(literal, ".") {
+					b.WriteString(regexp.QuoteMeta(strings.TrimSuffix(literal, ".")) + `(?: \(\d+\))?\.`)
+					continue
+				}
+				b.WriteString(regexp.QuoteMeta(literal))
+				continue
+			}
+			group := `[^/]+?`
+			switch part.field {
+			case "ep":
+				group = `[^/.]+?(?:\.\d+)?`
+			case "lang":
+				group = `sub|dub`
+			case "ext":
+				group = videoExtensions
+			case "dub":
+				b.WriteString(`(?P<dub> \[dub\])?`)
+				continue
+			}
+			if seen[part.field] {
+				b.WriteString("(?:" + group + ")")
+			} else {
+				b.WriteString("(?P<" + part.field + ">" + group + ")")
+				seen[part.field] = true
+			}
+		}
+		segments[i] = b.String()
+	}
+	return regexp.MustCompile("^" + strings.Join(segments, "/") + "$")
+}
+
+// unpadEpisode reverses padEpisode so parsed file names map back to API episode IDs
+func unpadEpisode(id string) string {
+	whole, frac, hasFrac := strings.Cut(id, ".")
+	if !isDigits(whole) {
+		return id
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	if hasFrac {
+		return whole + "." + frac
+	}
+	return whole
+}
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+/*
+sanitizeFileName makes s safe as a single path segment on Linux, macOS and Windows:
+path separators and characters Windows forbids are replaced or dropped, control
+characters are removed, trailing dots and spaces are trimmed, reserved device names
+are suffixed and the result is capped at maxSegmentLength bytes.
+*/
+func sanitizeFileName(s string) string {
+	s = strings.ReplaceAll(s, ": ", " - ")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '/' || r == '\\' || r == '|' || r == ':':
+			b.WriteRune('-')
+		case r == '?' || r == '*' || r == '"' || r == '<' || r == '>':
+		case unicode.IsControl(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name := strings.Join(strings.Fields(b.String()), " ")
+	for len(name) > maxSegmentLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(base)] {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,64 @@
+package src
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilenameTemplateRender(t *testing.T) {
+	tmpl, err := parseFilenameTemplate(defaultFilenameTemplate)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		title    string
+		ref      EpisodeRef
+		expected string
+	}{
+		{name: "Padded episode", title: "Frieren", ref: EpisodeRef{ID: "7", Type: "sub"}, expected: "Frieren/Frieren - E007 [sub].mp4"},
+		{name: "Fractional episode", title: "Frieren", ref: EpisodeRef{ID: "12.5", Type: "dub"}, expected: "Frieren/Frieren - E012.5 [dub].mp4"},
+		{name: "Special keeps its ID", title: "Frieren", ref: EpisodeRef{ID: "OVA 1", Type: "sub"}, expected: "Frieren/Frieren - EOVA 1 [sub].mp4"},
+		{name: "Slash and colon in title", title: "Fate/Zero: Part 2", ref: EpisodeRef{ID: "1", Type: "sub"}, expected: "Fate-Zero - Part 2/Fate-Zero - Part 2 - E001 [sub].mp4"},
+		{name: "Windows unsafe characters", title: `Why? <"Me">*`, ref: EpisodeRef{ID: "1", Type: "sub"}, expected: "Why Me/Why Me - E001 [sub].mp4"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tmpl.Render(templateValues{Title: tc.title, Ref: tc.ref, Ext: "mp4"}))
+		})
+	}
+}
+
+func TestFilenameTemplateValidation(t *testing.T) {
+	for _, raw := range []string{"", "{title}/../{ep}", "{title}/{episode}.mp4", "{ep}/{title}.mp4"} {
+		_, err := parseFilenameTemplate(raw)
+		assert.Error(t, err, raw)
+	}
+	_, err := parseFilenameTemplate("/{title}_ep{ep}_{lang}.{ext}")
+	assert.NoError(t, err, "a leading slash is ignored rather than writing to /")
+}
+
+func TestFilenameTemplatePattern(t *testing.T) {
+	tmpl, _ := parseFilenameTemplate(defaultFilenameTemplate)
+	pattern := tmpl.Pattern()
+
+	match := pattern.FindStringSubmatch("Fate-Zero - Part 2/Fate-Zero - Part 2 - E012.5 [dub] (2).mp4")
+	assert.NotNil(t, match)
+	assert.Equal(t, "Fate-Zero - Part 2", match[pattern.SubexpIndex("title")])
+	assert.Equal(t, "12.5", unpadEpisode(match[pattern.SubexpIndex("ep")]))
+	assert.Equal(t, "dub", match[pattern.SubexpIndex("lang")])
+
+	assert.Nil(t, pattern.FindStringSubmatch("Frieren/notes.txt"))
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	assert.Equal(t, "_CON", sanitizeFileName("CON"))
+	assert.Equal(t, "_", sanitizeFileName("..."))
+	assert.Equal(t, "a b", sanitizeFileName("a\t\n b. "))
+	long := sanitizeFileName(strings.Repeat("日本語", 100))
+	assert.LessOrEqual(t, len(long), maxSegmentLength)
+	assert.True(t, utf8.ValidString(long), "truncation never splits a rune")
+}
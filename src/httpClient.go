@@ -0,0 +1,317 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+appCtx is the root context of every network request Kaizen makes. It is cancelled
+by ExecuteAppStub when the TUI exits so searches, thumbnail fetches and downloads
+that are still in flight are aborted instead of outliving the program.
+*/
+var appCtx, cancelAppCtx = context.WithCancel(context.Background())
+
+// apiClient is the shared HTTP client used for the API, thumbnails and downloads
+var apiClient = newHTTPClient(conf)
+
+/*
+httpClient wraps http.Client with the behaviour every Kaizen request needs:
+  - a connect timeout (dial + TLS handshake) and a read timeout that fires when no
+    data arrives for that long, both for the response headers and the body
+  - retries with exponential backoff and jitter for idempotent requests that fail
+    with a network error or a 429/502/503/504 response
+  - per-host rate limiting so paging and thumbnails never hammer the API
+  - the configured proxy, User-Agent and extra headers on every request
+  - no network access at all while offline mode is on
+*/
+type httpClient struct {
+	client      *http.Client
+	readTimeout time.Duration
+	maxRetries  int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	limiter     *hostLimiter
+	headers     http.Header
+}
+
+// newHTTPClient builds the shared client from the Network section of config.yaml
+func newHTTPClient(c Config) *httpClient {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL, err := parseProxyURL(c.NetworkProxy); err != nil {
+		fmt.Fprintf(os.Stderr, "\033[0;33m [!] Ignoring Network.Proxy: %v \033[0m \n", err)
+	} else if proxyURL != nil {
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{Timeout: c.NetworkConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   c.NetworkConnectTimeout,
+		ResponseHeaderTimeout: c.NetworkReadTimeout,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &httpClient{
+		client:      &http.Client{Transport: transport},
+		readTimeout: c.NetworkReadTimeout,
+		maxRetries:  c.NetworkMaxRetries,
+		baseDelay:   c.NetworkRetryDelay,
+		maxDelay:    30 * time.Second,
+		limiter:     newHostLimiter(c.NetworkRequestsPerSecond),
+		headers:     networkHeaders(c),
+	}
+}
+
+/*
+parseProxyURL validates the Network.Proxy setting. http, https and socks5 proxies
+are supported; an empty setting returns nil so the environment (HTTP_PROXY etc.) is used.
+*/
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", proxy)
+	}
+	return u, nil
+}
+
+// networkHeaders returns the User-Agent and extra headers configured in config.yaml
+func networkHeaders(c Config) http.Header {
+	headers := http.Header{}
+	for name, value := range c.NetworkHeaders {
+		headers.Set(name, value)
+	}
+	if c.NetworkUserAgent != "" {
+		headers.Set("User-Agent", c.NetworkUserAgent)
+	}
+	return headers
+}
+
+// Get issues a GET request bound to ctx
+func (c *httpClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+/*
+Do sends req, retrying idempotent requests on transient failures. The request's
+context bounds the whole operation including the backoff sleeps, and the returned
+body is guarded by the read timeout: if no data arrives for that long the request
+is aborted and the pending Read returns an error.
+*/
+func (c *httpClient) Do(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		attempts += c.maxRetries
+	}
+	return c.do(req, attempts)
+}
+
+/*
+DoOnce sends req like Do but without retrying it, for callers that retry on their own
+terms, such as the download engine with DownloadRetries. A retryable status is
+returned as the response.
+*/
+func (c *httpClient) DoOnce(req *http.Request) (*http.Response, error) {
+	return c.do(req, 1)
+}
+
+// do sends req up to attempts times
+func (c *httpClient) do(req *http.Request, attempts int) (*http.Response, error) {
+	ctx := req.Context()
+	if offlineMode {
+		return nil, errOffline
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, c.backoff(attempt, lastErr)); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.limiter.Wait(ctx, req.URL.Host); err != nil {
+			return nil, err
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		attemptReq := req.Clone(reqCtx)
+		for name, values := range c.headers {
+			if attemptReq.Header.Get(name) == "" {
+				attemptReq.Header[name] = values
+			}
+		}
+		resp, err := c.client.Do(attemptReq)
+		if err != nil {
+			cancel()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		if retryableStatus(resp.StatusCode) && attempt < attempts-1 {
+			lastErr = &retryAfterError{status: resp.Status, wait: parseRetryAfter(resp.Header.Get("Retry-After"))}
+			resp.Body.Close()
+			cancel()
+			continue
+		}
+
+		resp.Body = newIdleTimeoutBody(resp.Body, cancel, c.readTimeout)
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// backoff returns the delay before the given retry attempt: base*2^(attempt-1) plus up to 50% jitter
+func (c *httpClient) backoff(attempt int, lastErr error) time.Duration {
+	var ra *retryAfterError
+	if errors.As(lastErr, &ra) && ra.wait > 0 && ra.wait <= c.maxDelay {
+		return ra.wait
+	}
+	delay := c.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfterError records a retryable response so the next attempt can honour Retry-After
+type retryAfterError struct {
+	status string
+	wait   time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("bad status: %s", e.status)
+}
+
+// parseRetryAfter understands the delay-seconds form of the Retry-After header
+func parseRetryAfter(value string) time.Duration {
+	secs, err := strconv.Atoi(value)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+/*
+idleTimeoutBody cancels the request when no Read completes within timeout.
+The timer is re-armed after every read, so slow-but-steady transfers are fine
+while a stalled connection is torn down instead of hanging forever.
+*/
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, cancel context.CancelFunc, timeout time.Duration) io.ReadCloser {
+	b := &idleTimeoutBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, cancel)
+	}
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.timer != nil {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+/*
+hostLimiter spaces out requests to the same host so that at most rate requests
+per second are started. A rate of zero or less disables limiting.
+*/
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newHostLimiter(rate float64) *hostLimiter {
+	l := &hostLimiter{next: make(map[string]time.Time)}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+// Wait blocks until a request to host may start, or ctx is cancelled
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleepContext(ctx, time.Until(slot))
+}
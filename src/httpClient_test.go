@@ -0,0 +1,135 @@
+package src
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestHTTPClient returns a client with short timeouts and delays suitable for tests
+func newTestHTTPClient(retries int) *httpClient {
+	return newHTTPClient(Config{
+		NetworkConnectTimeout: time.Second,
+		NetworkReadTimeout:    200 * time.Millisecond,
+		NetworkMaxRetries:     retries,
+		NetworkRetryDelay:     time.Millisecond,
+	})
+}
+
+func TestHTTPClientRetriesTransientStatus(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok")) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	resp, err := newTestHTTPClient(3).Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	resp, err = newTestHTTPClient(3).Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "non-idempotent requests must not be retried")
+}
+
+func TestHTTPClientReadTimeoutAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial")) //nolint:errcheck
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	resp, err := newTestHTTPClient(0).Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Error(t, err, "a stalled body should be aborted by the read timeout")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = newTestHTTPClient(3).Get(ctx, server.URL)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestHostLimiterSpacing(t *testing.T) {
+	limiter := newHostLimiter(20)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, limiter.Wait(context.Background(), "example.com"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "three requests at 20/s need at least two intervals")
+
+	start = time.Now()
+	assert.NoError(t, limiter.Wait(context.Background(), "other.example.com"))
+	assert.Less(t, time.Since(start), 40*time.Millisecond, "limits are tracked per host")
+}
+
+func TestHTTPClientProxyAndHeaders(t *testing.T) {
+	var seen http.Header
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		seen = r.Header.Clone()
+		w.Write([]byte("ok")) //nolint:errcheck
+	}))
+	defer proxy.Close()
+
+	client := newHTTPClient(Config{
+		NetworkConnectTimeout: time.Second,
+		NetworkReadTimeout:    time.Second,
+		NetworkProxy:          proxy.URL,
+		NetworkUserAgent:      "kaizen-test",
+		NetworkHeaders:        map[string]string{"x-token": "secret"},
+	})
+	resp, err := client.Get(context.Background(), "http://api.invalid/search")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&proxied), "requests should go through the configured proxy")
+	assert.Equal(t, "kaizen-test", seen.Get("User-Agent"))
+	assert.Equal(t, "secret", seen.Get("X-Token"))
+
+	_, err = parseProxyURL("ftp://example.com")
+	assert.Error(t, err)
+	u, err := parseProxyURL("socks5://127.0.0.1:1080")
+	assert.NoError(t, err)
+	assert.Equal(t, "socks5", u.Scheme)
+}
+
+func TestHTTPClientDoOnceDoesNotRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := newTestHTTPClient(3).DoOnce(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
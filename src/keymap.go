@@ -15,6 +15,21 @@ type keyMap struct {
 	CtrlTab   key.Binding
 	ToggleBox key.Binding
 	Help      key.Binding
+
+	HistoryPrev key.Binding
+	HistoryNext key.Binding
+
+	Filter       key.Binding
+	SortScore    key.Binding
+	SortEpisodes key.Binding
+	SortTitle    key.Binding
+
+	JumpEpisode key.Binding
+	ServeStream key.Binding
+	Retry       key.Binding
+
+	LibraryDelete key.Binding
+	LibraryRescan key.Binding
 }
 
 /* newKeyMap
@@ -68,5 +83,49 @@ func newKeyMap() keyMap {
 			key.WithKeys("?"),
 			key.WithHelp("?", "show/hide help menu"),
 		),
+		HistoryPrev: key.NewBinding(
+			key.WithKeys("up"),
+			key.WithHelp("↑", "previous search"),
+		),
+		HistoryNext: key.NewBinding(
+			key.WithKeys("down"),
+			key.WithHelp("↓", "next search"),
+		),
+		Filter: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "filter results"),
+		),
+		SortScore: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "sort by score"),
+		),
+		SortEpisodes: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "sort by episode count"),
+		),
+		SortTitle: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "sort by title"),
+		),
+		JumpEpisode: key.NewBinding(
+			key.WithKeys(":", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"),
+			key.WithHelp(":", "jump to episode"),
+		),
+		ServeStream: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "serve episode on a local URL"),
+		),
+		Retry: key.NewBinding(
+			key.WithKeys("ctrl+r"),
+			key.WithHelp("ctrl+r", "retry failed request"),
+		),
+		LibraryDelete: key.NewBinding(
+			key.WithKeys("d", "delete"),
+			key.WithHelp("d", "delete downloaded episode"),
+		),
+		LibraryRescan: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "rescan library"),
+		),
 	}
 }
@@ -2,6 +2,7 @@ package src
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"image"
@@ -33,7 +34,8 @@ func getCacheKey(url string, width, height int) string {
 // requested pixel dimensions (always 200x300 in our usage), encodes it as PNG
 // and returns the Kitty graphics protocol escape sequence as a string. The
 // caller can render that string directly into the terminal output.
-func RenderKittyImageFromURL(url string, width, height int) (string, error) {
+// The download uses the shared apiClient and is abandoned when ctx is cancelled.
+func RenderKittyImageFromURL(ctx context.Context, url string, width, height int) (string, error) {
 	if url == "" {
 		return "", nil
 	}
@@ -47,7 +49,7 @@ func RenderKittyImageFromURL(url string, width, height int) (string, error) {
 	}
 	imageCache.RUnlock()
 
-	resp, err := http.Get(url)
+	resp, err := apiClient.Get(ctx, url)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch image: %w", err)
 	}
@@ -0,0 +1,190 @@
+package src
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// legacyFilePattern matches the <name>_ep<N>_<sub|dub>.mp4 names used before FilenameTemplate
+var legacyFilePattern = regexp.MustCompile(`^(.+)_ep(.+)_(sub|dub)\.mp4$`)
+
+// libraryEpisode is one downloaded episode file
+type libraryEpisode struct {
+	path string
+	ref  EpisodeRef
+	size int64
+}
+
+/*
+libraryShow groups the downloaded episodes of one anime. name is the anime name as
+used for its download directory, and size is the total disk usage of its episodes.
+*/
+type libraryShow struct {
+	name     string
+	episodes []libraryEpisode
+	size     int64
+}
+
+/*
+parseLibraryFile extracts the anime name and episode from the path of a downloaded file.
+Paths are first matched against the FilenameTemplate pattern; the show is named by
+{title}, or by the first directory when the template has no title. Files that don't match
+are tried against the legacy naming, where the name comes from the per-anime directory
+or the file itself (underscores turned back into spaces). Names are sanitized the same
+way as in file names so both layouts of a show group together.
+*/
+func parseLibraryFile(root, path string, pattern *regexp.Regexp) (string, EpisodeRef, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", EpisodeRef{}, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	if pattern != nil {
+		if match := pattern.FindStringSubmatch(rel); match != nil {
+			group := func(name string) string {
+				if i := pattern.SubexpIndex(name); i >= 0 {
+					return match[i]
+				}
+				return ""
+			}
+			name := group("title")
+			if name == "" {
+				name, _, _ = strings.Cut(rel, "/")
+			}
+			lang := group("lang")
+			if lang == "" {
+				lang = "sub"
+				if group("dub") != "" {
+					lang = "dub"
+				}
+			}
+			if ref, err := ParseEpisodeRef(unpadEpisode(group("ep")), lang); err == nil {
+				return sanitizeFileName(name), ref, true
+			}
+		}
+	}
+
+	match := legacyFilePattern.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return "", EpisodeRef{}, false
+	}
+	ref, err := ParseEpisodeRef(match[2], match[3])
+	if err != nil {
+		return "", EpisodeRef{}, false
+	}
+
+	name := strings.ReplaceAll(match[1], "_", " ")
+	if dir := filepath.Dir(path); filepath.Clean(dir) != filepath.Clean(root) {
+		name = filepath.Base(dir)
+	}
+	return sanitizeFileName(name), ref, true
+}
+
+/*
+scanLibrary walks root and returns the downloaded episodes grouped by show, shows
+sorted by name and episodes by number. Files that do not follow the download naming
+scheme are ignored. A missing root is an empty library, not an error.
+
+Only the directories a download can end up in are walked: hidden directories are
+skipped, and so is anything nested deeper than the FilenameTemplate (or the legacy
+per-anime directory) goes, so a root like $HOME is not searched as a whole.
+*/
+func scanLibrary(root string) ([]libraryShow, error) {
+	var pattern *regexp.Regexp
+	maxDepth := 1
+	if tmpl, err := downloadTemplate(); err == nil {
+		pattern = tmpl.Pattern()
+		maxDepth = max(len(tmpl.segments)-1, maxDepth)
+	}
+
+	shows := make(map[string]*libraryShow)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || strings.HasPrefix(d.Name(), ".") || strings.Count(filepath.ToSlash(rel), "/")+1 > maxDepth {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		name, ref, ok := parseLibraryFile(root, path, pattern)
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		show := shows[name]
+		if show == nil {
+			show = &libraryShow{name: name}
+			shows[name] = show
+		}
+		show.episodes = append(show.episodes, libraryEpisode{path: path, ref: ref, size: info.Size()})
+		show.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	library := make([]libraryShow, 0, len(shows))
+	for _, show := range shows {
+		sort.Slice(show.episodes, func(i, j int) bool {
+			a, b := show.episodes[i].ref, show.episodes[j].ref
+			if a.Number != b.Number {
+				return a.Number < b.Number
+			}
+			return a.Type < b.Type
+		})
+		library = append(library, *show)
+	}
+	sort.Slice(library, func(i, j int) bool {
+		return strings.ToLower(library[i].name) < strings.ToLower(library[j].name)
+	})
+	return library, nil
+}
+
+/*
+deleteLibraryEpisode removes a downloaded episode and, when it was the last file in
+its per-anime directory, the directory as well.
+*/
+func deleteLibraryEpisode(root string, episode libraryEpisode) error {
+	if err := os.Remove(episode.path); err != nil {
+		return err
+	}
+	dir := filepath.Dir(episode.path)
+	if filepath.Clean(dir) != filepath.Clean(root) {
+		os.Remove(dir) //nolint:errcheck // fails harmlessly when other files remain
+	}
+	return nil
+}
+
+// formatSize renders a byte count with a binary unit, e.g. 1.4 GiB
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,422 @@
+package src
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// libraryScanTTL is how long the server reuses a library scan; a page load requests one cover per show
+var libraryScanTTL = 5 * time.Second
+
+// posterNames are the cover images looked for in a show's directories, as written by MediaServerLayout and other tools
+var posterNames = []string{"poster.jpg", "cover.jpg", "folder.jpg"}
+
+/*
+libraryServer shares the download directory over HTTP so downloaded episodes can be
+watched on a TV or another device: an HTML index of the shows, a page and an M3U
+playlist per show, cover images and the episode files themselves with range support.
+Only episodes found by scanLibrary and poster images are served, never other files
+below the root, and symlinks leading out of the root are refused. With a token set
+every request has to carry it, as ?token= or as a bearer Authorization header; the
+links the server generates include it.
+*/
+type libraryServer struct {
+	root    string
+	token   string
+	watched *WatchHistory
+	mux     *http.ServeMux
+
+	mu      sync.Mutex
+	shows   []libraryShow
+	scanned time.Time
+}
+
+func newLibraryServer(root, token string, watched *WatchHistory) *libraryServer {
+	s := &libraryServer{root: root, token: token, watched: watched, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /{$}", s.serveIndex)
+	s.mux.HandleFunc("GET /show/{name}/{$}", s.serveShow)
+	s.mux.HandleFunc("GET /show/{name}/playlist.m3u", s.servePlaylist)
+	s.mux.HandleFunc("GET /show/{name}/cover", s.serveCover)
+	s.mux.HandleFunc("GET /media/{path...}", s.serveMedia)
+	return s
+}
+
+func (s *libraryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		given := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			given = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			http.Error(w, "a valid token is required", http.StatusUnauthorized)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// link returns path with the token attached
+func (s *libraryServer) link(path string) string {
+	if s.token == "" {
+		return path
+	}
+	return path + "?token=" + url.QueryEscape(s.token)
+}
+
+// showPath returns the URL path of a show's page, or of a file below it
+func showPath(name, file string) string {
+	return "/show/" + url.PathEscape(name) + "/" + file
+}
+
+// episodeRel returns the slash-separated path of an episode file below the root
+func (s *libraryServer) episodeRel(episode libraryEpisode) string {
+	rel, err := filepath.Rel(s.root, episode.path)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// mediaPath returns the URL path an episode file is served at
+func (s *libraryServer) mediaPath(episode libraryEpisode) string {
+	rel := s.episodeRel(episode)
+	if rel == "" {
+		return ""
+	}
+	segments := strings.Split(rel, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/media/" + strings.Join(segments, "/")
+}
+
+/*
+library returns the shows in the download directory, rescanning it at most once per
+libraryScanTTL. Requests arriving during a scan wait for it and share its result.
+*/
+func (s *libraryServer) library() ([]libraryShow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.scanned) < libraryScanTTL {
+		return s.shows, nil
+	}
+	shows, err := scanLibrary(s.root)
+	if err != nil {
+		return nil, err
+	}
+	s.shows, s.scanned = shows, time.Now()
+	return shows, nil
+}
+
+// show looks up the show called name in the library
+func (s *libraryServer) show(name string) (libraryShow, bool) {
+	shows, err := s.library()
+	if err != nil {
+		return libraryShow{}, false
+	}
+	for _, show := range shows {
+		if show.name == name {
+			return show, true
+		}
+	}
+	return libraryShow{}, false
+}
+
+var libraryPageStyle = `body{font-family:sans-serif;background:#16161e;color:#c0caf5;margin:2rem}
+a{color:#b3befe;text-decoration:none}h1{font-weight:normal}
+.shows{display:flex;flex-wrap:wrap;gap:1.5rem}.show{width:180px}
+.show img,.cover{width:180px;height:255px;object-fit:cover;background:#24283b;border-radius:6px}
+.show span,small{display:block}small{color:#737aa2}li{margin:.4rem 0}`
+
+var libraryIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Kaizen</title><style>{{.Style}}</style></head><body>
+<h1>Kaizen</h1>
+{{if not .Shows}}<p>No downloads yet.</p>{{end}}
+<div class="shows">{{range .Shows}}
+<a class="show" href="{{.Link}}"><img src="{{.Cover}}" alt="" loading="lazy"><span>{{.Name}}</span><small>{{.Episodes}} episodes • {{.Size}}</small></a>{{end}}
+</div></body></html>
+`))
+
+var libraryShowTemplate = template.Must(template.New("show").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title><style>{{.Style}}</style></head><body>
+<p><a href="{{.Home}}">← All shows</a></p>
+<img class="cover" src="{{.Cover}}" alt="">
+<h1>{{.Name}}</h1>
+<p><a href="{{.Playlist}}">▶ Play all (M3U playlist)</a></p>
+<ul>{{range .Episodes}}
+<li><a href="{{.Link}}">{{.Title}}</a> <small>{{.Size}}</small></li>{{end}}
+</ul></body></html>
+`))
+
+// libraryCard is a show on the index page
+type libraryCard struct {
+	Name, Link, Cover, Size string
+	Episodes                int
+}
+
+// libraryEpisodeLink is an episode on a show page
+type libraryEpisodeLink struct {
+	Title, Link, Size string
+}
+
+func (s *libraryServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	shows, err := s.library()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var cards []libraryCard
+	for _, show := range shows {
+		cards = append(cards, libraryCard{
+			Name:     show.name,
+			Link:     s.link(showPath(show.name, "")),
+			Cover:    s.link(showPath(show.name, "cover")),
+			Size:     formatSize(show.size),
+			Episodes: len(show.episodes),
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	libraryIndexTemplate.Execute(w, map[string]any{"Style": template.CSS(libraryPageStyle), "Shows": cards}) //nolint:errcheck
+}
+
+func (s *libraryServer) serveShow(w http.ResponseWriter, r *http.Request) {
+	show, ok := s.show(r.PathValue("name"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var episodes []libraryEpisodeLink
+	for _, episode := range show.episodes {
+		episodes = append(episodes, libraryEpisodeLink{
+			Title: fmt.Sprintf("%s (%s)", episode.ref.Label(), strings.ToUpper(episode.ref.Type)),
+			Link:  s.link(s.mediaPath(episode)),
+			Size:  formatSize(episode.size),
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	libraryShowTemplate.Execute(w, map[string]any{ //nolint:errcheck
+		"Style":    template.CSS(libraryPageStyle),
+		"Name":     show.name,
+		"Home":     s.link("/"),
+		"Cover":    s.link(showPath(show.name, "cover")),
+		"Playlist": s.link(showPath(show.name, "playlist.m3u")),
+		"Episodes": episodes,
+	})
+}
+
+// servePlaylist lists the episodes of a show as an M3U playlist with absolute URLs, for players that open playlists
+func (s *libraryServer) servePlaylist(w http.ResponseWriter, r *http.Request) {
+	show, ok := s.show(r.PathValue("name"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	base := "http://" + r.Host
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n")
+	for _, episode := range show.episodes {
+		fmt.Fprintf(&playlist, "#EXTINF:-1,%s %s (%s)\n%s\n", show.name, episode.ref.Label(), strings.ToUpper(episode.ref.Type), base+s.link(s.mediaPath(episode)))
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", show.name+".m3u"))
+	io.WriteString(w, playlist.String()) //nolint:errcheck
+}
+
+/*
+serveCover sends the cover of a show: a poster image in its directory when there is
+one, otherwise the thumbnail of the anime from the metadata cache.
+*/
+func (s *libraryServer) serveCover(w http.ResponseWriter, r *http.Request) {
+	show, ok := s.show(r.PathValue("name"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if poster, ok := s.poster(show); ok {
+		s.serveFile(w, r, poster)
+		return
+	}
+
+	thumbnail := s.thumbnail(show.name)
+	if thumbnail == "" {
+		http.NotFound(w, r)
+		return
+	}
+	resp, err := apiClient.Get(r.Context(), thumbnail)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("Cache-Control", "max-age=86400")
+	io.Copy(w, resp.Body) //nolint:errcheck
+}
+
+/*
+poster finds a cover image next to the show's episodes or in a parent directory below
+the root, returning its path relative to the root.
+*/
+func (s *libraryServer) poster(show libraryShow) (string, bool) {
+	if len(show.episodes) == 0 {
+		return "", false
+	}
+	for dir := path.Dir(s.episodeRel(show.episodes[0])); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, name := range posterNames {
+			rel := path.Join(dir, name)
+			if info, err := s.stat(rel); err == nil && info.Mode().IsRegular() {
+				return rel, true
+			}
+		}
+	}
+	return "", false
+}
+
+// thumbnail returns the thumbnail URL of the anime a show was downloaded from, as found in the metadata cache
+func (s *libraryServer) thumbnail(name string) string {
+	if id, ok := s.watched.IDForTitle(name); ok {
+		var anime Anime
+		if _, ok := responseCache.Get("anime:"+id, &anime); ok && anime.Thumbnail != "" {
+			return anime.Thumbnail
+		}
+	}
+	var thumbnail string
+	responseCache.Each("anime:", 0, func(entry cacheEntry) {
+		var anime Anime
+		if thumbnail == "" && json.Unmarshal(entry.Data, &anime) == nil && sanitizeFileName(anime.Title) == name {
+			thumbnail = anime.Thumbnail
+		}
+	})
+	return thumbnail
+}
+
+// serveMedia sends an episode file, supporting range requests for seeking
+func (s *libraryServer) serveMedia(w http.ResponseWriter, r *http.Request) {
+	if !s.isEpisode(r.PathValue("path")) {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveFile(w, r, r.PathValue("path"))
+}
+
+// isEpisode reports whether rel is the path of an episode in the library
+func (s *libraryServer) isEpisode(rel string) bool {
+	shows, err := s.library()
+	if err != nil {
+		return false
+	}
+	for _, show := range shows {
+		for _, episode := range show.episodes {
+			if s.episodeRel(episode) == rel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stat returns information about the file at rel without following symlinks out of the root
+func (s *libraryServer) stat(rel string) (os.FileInfo, error) {
+	file, err := os.OpenInRoot(s.root, filepath.FromSlash(rel))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// serveFile sends the regular file at rel below the root; symlinks leading out of the root are refused
+func (s *libraryServer) serveFile(w http.ResponseWriter, r *http.Request, rel string) {
+	file, err := os.OpenInRoot(s.root, filepath.FromSlash(rel))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// isLoopback reports whether a listener only accepts connections from this machine
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+/*
+ServeLibrary runs the serve command: it shares the download directory on the local
+network until interrupted, printing the address to open on the TV. Listening beyond
+this machine requires a token, so the library is never open to the whole network.
+*/
+func ServeLibrary(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := flags.String("listen", conf.ServeListen, "address to listen on")
+	token := flags.String("token", conf.ServeToken, "token every request has to carry; required unless listening on 127.0.0.1")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: kaizen serve [-listen address] [-token token]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %v", *listen, err)
+	}
+	if *token == "" && !isLoopback(listener.Addr()) {
+		listener.Close()
+		return fmt.Errorf("serving on %s makes the library reachable from other devices: set Serve.Token or pass -token", *listen)
+	}
+	root := libraryRoot()
+	server := &http.Server{
+		Handler:           newLibraryServer(root, *token, LoadWatchHistory(watchHistoryPath())),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(appCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	link := "http://" + listenerHost(listener.Addr()) + "/"
+	if *token != "" {
+		link += "?token=" + url.QueryEscape(*token)
+	}
+	fmt.Printf("\033[0;32m [+] Serving %s at\033[0m\n     %s\n     press Ctrl+C to stop\n", root, link)
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package src
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLibraryServer(t *testing.T, token string) (*httptest.Server, string) {
+	root := t.TempDir()
+	writeLibraryFile(t, filepath.Join(root, "Frieren - Beyond", "Frieren_Beyond_ep1_sub.mp4"), 100)
+	writeLibraryFile(t, filepath.Join(root, "Frieren - Beyond", "Frieren_Beyond_ep2_sub.mp4"), 200)
+	writeLibraryFile(t, filepath.Join(root, "Dungeon_Meshi_ep1_sub.mp4"), 50)
+	server := httptest.NewServer(newLibraryServer(root, token, &WatchHistory{}))
+	t.Cleanup(server.Close)
+	return server, root
+}
+
+func getBody(t *testing.T, req *http.Request) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestLibraryServerPages(t *testing.T) {
+	server, _ := newTestLibraryServer(t, "")
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	resp, body := getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "Frieren - Beyond")
+	assert.Contains(t, body, `href="/show/Frieren%20-%20Beyond/"`)
+	assert.Contains(t, body, "Dungeon Meshi")
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/show/Frieren%20-%20Beyond/", nil)
+	resp, body = getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `href="/media/Frieren%20-%20Beyond/Frieren_Beyond_ep2_sub.mp4"`)
+	assert.Contains(t, body, "playlist.m3u")
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/show/Missing/", nil)
+	resp, _ = getBody(t, req)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestLibraryServerPlaylist(t *testing.T) {
+	server, _ := newTestLibraryServer(t, "secret")
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/show/Frieren%20-%20Beyond/playlist.m3u?token=secret", nil)
+	resp, body := getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXTINF:-1,Frieren - Beyond Episode 1 (SUB)\n"+server.URL+"/media/Frieren%20-%20Beyond/Frieren_Beyond_ep1_sub.mp4?token=secret\n"+
+		"#EXTINF:-1,Frieren - Beyond Episode 2 (SUB)\n"+server.URL+"/media/Frieren%20-%20Beyond/Frieren_Beyond_ep2_sub.mp4?token=secret\n", body)
+}
+
+func TestLibraryServerToken(t *testing.T) {
+	server, _ := newTestLibraryServer(t, "secret")
+
+	for _, path := range []string{"/", "/?token=wrong", "/media/Dungeon_Meshi_ep1_sub.mp4"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		resp, _ := getBody(t, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, path)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/?token=secret", nil)
+	resp, body := getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `href="/show/Dungeon%20Meshi/?token=secret"`, "links carry the token")
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, _ = getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestLibraryServerMedia(t *testing.T) {
+	server, root := newTestLibraryServer(t, "")
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "Dungeon_Meshi_ep1_sub.mp4"), []byte("0123456789"), 0644))
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	assert.NoError(t, os.WriteFile(outside, []byte("secret"), 0644))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "Leak_ep1_sub.mp4")))
+	writeLibraryFile(t, filepath.Join(root, "notes.txt"), 10)
+	writeLibraryFile(t, filepath.Join(root, "Frieren - Beyond", "Frieren_Beyond_ep3_sub.mp4.part"), 10)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/media/Dungeon_Meshi_ep1_sub.mp4", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	resp, body := getBody(t, req)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "2345", body)
+	assert.Equal(t, "bytes 2-5/10", resp.Header.Get("Content-Range"))
+
+	for _, path := range []string{
+		"/media/..%2fsecret.txt", "/media/Missing.mp4", "/media/Frieren%20-%20Beyond",
+		"/media/notes.txt", "/media/Frieren%20-%20Beyond/Frieren_Beyond_ep3_sub.mp4.part", "/media/Leak_ep1_sub.mp4",
+	} {
+		req, _ = http.NewRequest(http.MethodGet, server.URL+path, nil)
+		resp, _ = getBody(t, req)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+func TestLibraryServerCover(t *testing.T) {
+	defaultCache := responseCache
+	responseCache = newAPICache(t.TempDir())
+	defer func() { responseCache = defaultCache }()
+
+	server, root := newTestLibraryServer(t, "")
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "Frieren - Beyond", "poster.jpg"), []byte("poster"), 0644))
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/show/Frieren%20-%20Beyond/cover", nil)
+	resp, body := getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "poster", body)
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/show/Dungeon%20Meshi/cover", nil)
+	resp, _ = getBody(t, req)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "no poster and nothing cached")
+
+	thumbnails := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		io.WriteString(w, "thumbnail") //nolint:errcheck
+	}))
+	defer thumbnails.Close()
+	assert.NoError(t, responseCache.Put("anime:42", Anime{Title: "Dungeon Meshi", Thumbnail: thumbnails.URL + "/42.jpg"}))
+
+	resp, body = getBody(t, req)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "thumbnail", body, "the cached thumbnail is used without a poster")
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+}
+
+func TestServeLibraryRequiresTokenBeyondLoopback(t *testing.T) {
+	err := ServeLibrary([]string{"-listen", "0.0.0.0:0", "-token="})
+	assert.ErrorContains(t, err, "Serve.Token")
+}
+
+func TestLibraryServerReusesScan(t *testing.T) {
+	root := t.TempDir()
+	writeLibraryFile(t, filepath.Join(root, "Show", "Show_ep1_sub.mp4"), 10)
+	s := newLibraryServer(root, "", &WatchHistory{})
+
+	shows, err := s.library()
+	assert.NoError(t, err)
+	assert.Len(t, shows, 1)
+
+	writeLibraryFile(t, filepath.Join(root, "Other", "Other_ep1_sub.mp4"), 10)
+	shows, _ = s.library()
+	assert.Len(t, shows, 1, "a recent scan is reused")
+
+	s.scanned = time.Time{}
+	shows, _ = s.library()
+	assert.Len(t, shows, 2, "an expired scan is repeated")
+}
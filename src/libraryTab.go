@@ -0,0 +1,367 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	libraryShowsFocus = iota
+	libraryEpisodesFocus
+)
+
+/*
+LibraryModel is the Library tab. It lists the shows found in the download directory
+on the left and the selected show's downloaded episodes on the right, with their size
+and watched status. Episodes can be played locally in the configured player or deleted.
+*/
+type LibraryModel struct {
+	root          string
+	shows         []libraryShow
+	showList      list.Model
+	episodeList   list.Model
+	focus         int
+	watched       *WatchHistory
+	confirmDelete bool
+	status        string
+	scanErr       string
+	scanning      bool
+	scanID        int
+	showHelpMenu  bool
+	width         int
+	height        int
+}
+
+// libraryShowItem is a show in the Library tab's show list
+type libraryShowItem struct {
+	show libraryShow
+}
+
+func (i libraryShowItem) Title() string { return i.show.name }
+func (i libraryShowItem) Description() string {
+	return fmt.Sprintf("%d episodes • %s", len(i.show.episodes), formatSize(i.show.size))
+}
+func (i libraryShowItem) FilterValue() string { return i.show.name }
+
+// libraryEpisodeItem is a downloaded episode in the Library tab's episode list
+type libraryEpisodeItem struct {
+	episode libraryEpisode
+	watched bool
+}
+
+func (i libraryEpisodeItem) Title() string {
+	icon := iconStyle.Render("⚆ ")
+	if i.watched {
+		icon = watchedIconStyle.Render("● ")
+	}
+	return fmt.Sprintf("%s%s (%s)", icon, i.episode.ref.Label(), strings.ToUpper(i.episode.ref.Type))
+}
+func (i libraryEpisodeItem) Description() string { return formatSize(i.episode.size) }
+func (i libraryEpisodeItem) FilterValue() string { return i.episode.ref.Label() }
+
+// libraryRescanStatus is shown while a rescan asked for with r is running
+const libraryRescanStatus = "Rescanning library..."
+
+// libraryScannedMsg carries the result of the library scan started by Refresh with the same id
+type libraryScannedMsg struct {
+	id    int
+	shows []libraryShow
+	err   error
+}
+
+/*
+NewLibraryModel creates the Library tab sharing the watch history with the Watch Anime
+tab. The library is scanned when the tab is opened, not here.
+*/
+func NewLibraryModel(watched *WatchHistory) LibraryModel {
+	showList := list.New([]list.Item{}, list.NewDefaultDelegate(), 40, 20)
+	showList.Title = "Shows"
+	showList.SetShowHelp(false)
+	showList.SetFilteringEnabled(false)
+
+	episodeList := list.New([]list.Item{}, list.NewDefaultDelegate(), 40, 20)
+	episodeList.Title = "Episodes"
+	episodeList.SetShowHelp(false)
+	episodeList.SetFilteringEnabled(false)
+
+	if watched == nil {
+		watched = LoadWatchHistory(watchHistoryPath())
+	}
+	return LibraryModel{
+		root:        libraryRoot(),
+		showList:    showList,
+		episodeList: episodeList,
+		watched:     watched,
+	}
+}
+
+/*
+Refresh starts a rescan of the download directory. The walk runs in the returned
+command so a large library does not block the UI; the lists are rebuilt once its
+libraryScannedMsg arrives.
+*/
+func (m *LibraryModel) Refresh() tea.Cmd {
+	m.scanID++
+	m.scanning = true
+	id, root := m.scanID, m.root
+	return func() tea.Msg {
+		shows, err := scanLibrary(root)
+		return libraryScannedMsg{id: id, shows: shows, err: err}
+	}
+}
+
+/*
+applyScan rebuilds both lists from a finished scan, keeping the selected show when it
+is still there. Results of scans superseded by a newer one are dropped.
+*/
+func (m *LibraryModel) applyScan(msg libraryScannedMsg) {
+	if msg.id != m.scanID {
+		return
+	}
+	m.scanning = false
+	if m.watched == nil {
+		m.watched = LoadWatchHistory("")
+	}
+	selected := ""
+	if i, ok := m.showList.SelectedItem().(libraryShowItem); ok {
+		selected = i.show.name
+	}
+
+	m.scanErr = ""
+	if msg.err != nil {
+		m.scanErr = msg.err.Error()
+	}
+	m.shows = msg.shows
+
+	items := make([]list.Item, len(m.shows))
+	index := 0
+	for i, show := range m.shows {
+		items[i] = libraryShowItem{show: show}
+		if show.name == selected {
+			index = i
+		}
+	}
+	m.showList.SetItems(items)
+	m.showList.Select(index)
+	m.refreshEpisodes()
+	if len(m.episodeList.Items()) == 0 {
+		m.focus = libraryShowsFocus
+	}
+	if m.status == libraryRescanStatus {
+		m.status = "Library rescanned"
+	}
+}
+
+// refreshEpisodes fills the episode list for the selected show
+func (m *LibraryModel) refreshEpisodes() {
+	i, ok := m.showList.SelectedItem().(libraryShowItem)
+	if !ok {
+		m.episodeList.SetItems([]list.Item{})
+		return
+	}
+	animeID := m.animeID(i.show.name)
+	items := make([]list.Item, len(i.show.episodes))
+	for n, episode := range i.show.episodes {
+		items[n] = libraryEpisodeItem{
+			episode: episode,
+			watched: m.watched.IsWatched(animeID, episode.ref.Type, episode.ref.ID),
+		}
+	}
+	index := m.episodeList.Index()
+	m.episodeList.SetItems(items)
+	if index >= len(items) {
+		index = len(items) - 1
+	}
+	m.episodeList.Select(max(index, 0))
+}
+
+/*
+animeID returns the watch history key for a show. Shows watched or downloaded through
+the Watch Anime tab are matched by name to their API ID; anything else gets a local key
+so its watched markers still persist.
+*/
+func (m *LibraryModel) animeID(name string) string {
+	if id, ok := m.watched.IDForTitle(name); ok {
+		return id
+	}
+	return "local:" + name
+}
+
+func (m LibraryModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m LibraryModel) Update(msg tea.Msg) (LibraryModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case libraryScannedMsg:
+		m.applyScan(msg)
+		return m, nil
+	case tea.KeyMsg:
+		if m.showHelpMenu {
+			if key.Matches(msg, keys.Esc) || key.Matches(msg, keys.Help) {
+				m.showHelpMenu = false
+			}
+			return m, nil
+		}
+
+		if m.confirmDelete {
+			m.confirmDelete = false
+			m.status = ""
+			if msg.String() == "y" {
+				return m, m.deleteSelected()
+			}
+			return m, nil
+		}
+
+		switch {
+		case key.Matches(msg, keys.Esc):
+			return m, tea.Quit
+		case key.Matches(msg, keys.Help):
+			m.showHelpMenu = true
+			return m, nil
+		case key.Matches(msg, keys.LibraryRescan):
+			m.status = libraryRescanStatus
+			return m, m.Refresh()
+		case msg.String() == "left" || msg.String() == "h":
+			m.focus = libraryShowsFocus
+			return m, nil
+		case msg.String() == "right" || msg.String() == "l":
+			if len(m.episodeList.Items()) > 0 {
+				m.focus = libraryEpisodesFocus
+			}
+			return m, nil
+		case key.Matches(msg, keys.Enter):
+			if m.focus == libraryShowsFocus {
+				if len(m.episodeList.Items()) > 0 {
+					m.focus = libraryEpisodesFocus
+				}
+				return m, nil
+			}
+			m.playSelected()
+			return m, nil
+		case key.Matches(msg, keys.LibraryDelete):
+			if i, ok := m.episodeList.SelectedItem().(libraryEpisodeItem); ok && m.focus == libraryEpisodesFocus {
+				m.confirmDelete = true
+				m.status = fmt.Sprintf("Delete %s (%s)? y/n", i.episode.ref.Label(), formatSize(i.episode.size))
+			}
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		if m.focus == libraryShowsFocus {
+			index := m.showList.Index()
+			m.showList, cmd = m.showList.Update(msg)
+			if m.showList.Index() != index {
+				m.episodeList.Select(0)
+				m.refreshEpisodes()
+			}
+		} else {
+			m.episodeList, cmd = m.episodeList.Update(msg)
+		}
+		return m, cmd
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	}
+	return m, nil
+}
+
+// playSelected plays the selected episode file and marks it as watched
+func (m *LibraryModel) playSelected() {
+	showItem, ok := m.showList.SelectedItem().(libraryShowItem)
+	if !ok {
+		return
+	}
+	i, ok := m.episodeList.SelectedItem().(libraryEpisodeItem)
+	if !ok {
+		return
+	}
+
+	ref := i.episode.ref
+	title := fmt.Sprintf("%s %s (%s)", showItem.show.name, ref.Label(), strings.ToUpper(ref.Type))
+	if err := playStream(StreamDescriptor{URL: i.episode.path}, title); err != nil {
+		m.status = fmt.Sprintf("Playback failed: %v", err)
+		return
+	}
+
+	m.watched.MarkWatched(m.animeID(showItem.show.name), ref.Type, ref.ID)
+	m.watched.Save() //nolint:errcheck
+	i.watched = true
+	m.episodeList.SetItem(m.episodeList.Index(), i)
+}
+
+// deleteSelected removes the selected episode file and returns the rescan of the library
+func (m *LibraryModel) deleteSelected() tea.Cmd {
+	i, ok := m.episodeList.SelectedItem().(libraryEpisodeItem)
+	if !ok {
+		return nil
+	}
+	if err := deleteLibraryEpisode(m.root, i.episode); err != nil {
+		m.status = fmt.Sprintf("Could not delete: %v", err)
+		return nil
+	}
+	m.status = fmt.Sprintf("Deleted %s", i.episode.ref.Label())
+	return m.Refresh()
+}
+
+// totalSize returns the disk usage of every downloaded episode
+func (m LibraryModel) totalSize() int64 {
+	var total int64
+	for _, show := range m.shows {
+		total += show.size
+	}
+	return total
+}
+
+func (m LibraryModel) View() string {
+	if m.showHelpMenu {
+		tempModel := Tab1Model{width: m.width, height: m.height}
+		return lipgloss.NewStyle().Align(lipgloss.Center).Width(m.width).Render(tempModel.renderHelpMenu())
+	}
+
+	border := func(focused bool) lipgloss.Style {
+		color := conf.Tab1FocusInactive
+		if focused {
+			color = conf.Tab1FocusActive
+		}
+		return lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(color)).
+			Padding(0, 1)
+	}
+
+	listHeight := max(m.height-12, 10)
+	m.showList.SetSize(45, listHeight)
+	m.episodeList.SetSize(max(m.width-60, 30), listHeight)
+
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("242"))
+	if len(m.shows) == 0 {
+		empty := "No downloaded episodes in " + m.root
+		if m.scanning {
+			return lipgloss.NewStyle().Padding(2, 4).Render(dim.Render("Scanning " + m.root + "..."))
+		}
+		if m.scanErr != "" {
+			empty = "Could not read " + m.root + ": " + m.scanErr
+		}
+		return lipgloss.NewStyle().Padding(2, 4).Render(dim.Render(empty + "\n\nDownload episodes with ctrl+d, then press r to rescan."))
+	}
+
+	lists := lipgloss.JoinHorizontal(lipgloss.Top,
+		border(m.focus == libraryShowsFocus).Render(m.showList.View()),
+		border(m.focus == libraryEpisodesFocus).Render(m.episodeList.View()),
+	)
+
+	footer := dim.Render(fmt.Sprintf("%d shows • %s total • %s", len(m.shows), formatSize(m.totalSize()), m.root))
+	if m.status != "" {
+		footer += "  " + lipgloss.NewStyle().Foreground(lipgloss.Color(conf.Tab1SpinnerMsgColor)).Render(m.status)
+	}
+	hint := dim.Render("enter play • d delete • r rescan • ←/→ switch list • ? help")
+
+	return lipgloss.NewStyle().PaddingLeft(2).Render(lipgloss.JoinVertical(lipgloss.Left, lists, footer, hint))
+}
@@ -0,0 +1,96 @@
+package src
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLibraryFile(t *testing.T, path string, size int) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+}
+
+func TestScanLibrary(t *testing.T) {
+	root := t.TempDir()
+	writeLibraryFile(t, filepath.Join(root, "Frieren: Beyond", "Frieren_Beyond_ep10_sub.mp4"), 300)
+	writeLibraryFile(t, filepath.Join(root, "Frieren: Beyond", "Frieren_Beyond_ep2_sub.mp4"), 200)
+	writeLibraryFile(t, filepath.Join(root, "Frieren: Beyond", "Frieren_Beyond_ep2_dub.mp4"), 100)
+	writeLibraryFile(t, filepath.Join(root, "Frieren: Beyond", "notes.txt"), 10)
+	writeLibraryFile(t, filepath.Join(root, "Dungeon_Meshi_ep1_sub.mp4"), 50)
+	writeLibraryFile(t, filepath.Join(root, "Frieren - Beyond", "Frieren - Beyond - E003 [sub].mp4"), 400)
+	writeLibraryFile(t, filepath.Join(root, "Frieren - Beyond", "Frieren - Beyond - E003 [sub] (2).mp4"), 400)
+
+	shows, err := scanLibrary(root)
+	assert.NoError(t, err)
+	assert.Len(t, shows, 2)
+
+	assert.Equal(t, "Dungeon Meshi", shows[0].name, "shows outside a directory are named after the file")
+	assert.Equal(t, "Frieren - Beyond", shows[1].name, "legacy and templated downloads of a show are grouped")
+	assert.Equal(t, int64(1400), shows[1].size)
+
+	var order []string
+	for _, ep := range shows[1].episodes {
+		order = append(order, ep.ref.Type+":"+ep.ref.ID)
+	}
+	assert.Equal(t, []string{"dub:2", "sub:2", "sub:3", "sub:3", "sub:10"}, order)
+
+	missing, err := scanLibrary(filepath.Join(root, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestDeleteLibraryEpisode(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "Show", "Show_ep1_sub.mp4")
+	writeLibraryFile(t, path, 10)
+
+	shows, _ := scanLibrary(root)
+	assert.NoError(t, deleteLibraryEpisode(root, shows[0].episodes[0]))
+	assert.NoDirExists(t, filepath.Join(root, "Show"), "an emptied show directory is removed")
+	assert.DirExists(t, root)
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "1.5 GiB", formatSize(1500*1024*1024))
+}
+
+func TestScanLibrarySkipsUnrelatedDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeLibraryFile(t, filepath.Join(root, "Show", "Show - E001 [sub].mp4"), 10)
+	writeLibraryFile(t, filepath.Join(root, ".cache", "Hidden", "Hidden - E001 [sub].mp4"), 10)
+	writeLibraryFile(t, filepath.Join(root, "Projects", "Deep", "Deep", "Deep - E001 [sub].mp4"), 10)
+
+	shows, err := scanLibrary(root)
+	assert.NoError(t, err)
+	if assert.Len(t, shows, 1) {
+		assert.Equal(t, "Show", shows[0].name, "hidden directories and directories deeper than the template are skipped")
+	}
+}
+
+func TestLibraryModelScansInBackground(t *testing.T) {
+	root := t.TempDir()
+	writeLibraryFile(t, filepath.Join(root, "Show", "Show_ep1_sub.mp4"), 10)
+
+	m := NewLibraryModel(&WatchHistory{})
+	m.root = root
+	assert.Empty(t, m.shows, "creating the tab does not scan")
+
+	stale := m.Refresh()
+	scan := m.Refresh()
+	assert.True(t, m.scanning)
+
+	m, _ = m.Update(stale())
+	assert.True(t, m.scanning, "the result of a superseded scan is dropped")
+	m, _ = m.Update(scan())
+	assert.False(t, m.scanning)
+	if assert.Len(t, m.shows, 1) {
+		assert.Equal(t, "Show", m.shows[0].name)
+	}
+	assert.Len(t, m.episodeList.Items(), 1)
+}
@@ -1,13 +1,9 @@
 package src
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
@@ -20,18 +16,15 @@ import (
 
 // var conf = LoadConfig()
 
-var (
-	downloadPaused    bool
-	downloadCancelled bool
-	downloadID        int
-)
-
 type downloadStatusUpdate struct {
-	id       int
-	progress float64
-	complete bool
-	error    error
-	filePath string
+	id         int
+	progress   float64
+	complete   bool
+	error      error
+	filePath   string
+	downloaded int64
+	total      int64
+	retries    int
 }
 
 type AppState int
@@ -59,6 +52,16 @@ type DownloadModel struct {
 	downloadError   string
 	isDownloading   bool
 	isPaused        bool
+	downloadID      int
+	media           *mediaInfo
+	job             downloadJob
+	history         *DownloadHistory
+	jobKey          string
+	resolving       bool
+	historyList     list.Model
+	showHistory     bool
+	schedule        downloadSchedule
+	retries         int
 }
 
 const (
@@ -75,14 +78,23 @@ type MainModel struct {
 	width            int
 	height           int
 	tab1             Tab1Model
+	library          LibraryModel
 	tab2             Tab2Model
 	styles           Styles
 	currentScreen    AppState
 	downloadM        DownloadModel
+	downloads        *downloadEngine
 	DownloadFileName string
+	restorePrompt    bool
 }
 
-var tabNames = []string{"Watch Anime", "About"}
+var tabNames = []string{"Watch Anime", "Library", "About"}
+
+const (
+	watchTab = iota
+	libraryTab
+	aboutTab
+)
 
 type AnimeSelectedMsg struct {
 	AnimeID              string
@@ -93,22 +105,6 @@ type AnimeSelectedMsg struct {
 	AnimeType            string
 }
 
-type downloadProgressMsg struct {
-	percent float64
-	err     error
-}
-
-type downloadCompleteMsg struct {
-	filePath string
-	err      error
-}
-
-func downloadProgressCmd() tea.Cmd {
-	return func() tea.Msg {
-		return progressTickMsg{}
-	}
-}
-
 func NewMainModel() MainModel {
 	p := progress.New(
 		progress.WithSolidFill(conf.defaultActiveTabDark),
@@ -127,6 +123,11 @@ func NewMainModel() MainModel {
 	dubList.SetShowHelp(false)
 	dubList.SetFilteringEnabled(false)
 
+	historyList := list.New([]list.Item{}, delegate, 82, 15)
+	historyList.Title = "Download History"
+	historyList.SetShowHelp(false)
+	historyList.SetFilteringEnabled(false)
+
 	return MainModel{
 		downloadM: DownloadModel{
 			progress:        p,
@@ -143,25 +144,15 @@ func NewMainModel() MainModel {
 			downloadError:   "",
 			isDownloading:   false,
 			isPaused:        false,
+			history:         LoadDownloadHistory(""),
+			historyList:     historyList,
+			schedule:        downloadSchedule{open: true},
 		},
 	}
 }
 
 func (m MainModel) Init() tea.Cmd {
-
-	if downloadStatusCh == nil {
-		downloadStatusCh = make(chan downloadStatusUpdate, 100)
-	}
-
-	return nil
-}
-
-func progressTick() tea.Msg {
-	return progressTickMsg{}
-}
-
-type progressTickMsg struct {
-	downloadID int
+	return tea.Batch(listenDownloads(m.downloads), listenDownloadSchedule(m.downloads))
 }
 
 /* Update handles incoming messages and updates the MainModel's state.
@@ -182,6 +173,8 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		m.tab1.width = m.width
 		m.tab1.height = m.height
+		m.library.width = m.width
+		m.library.height = m.height
 		m.tab2.width = m.width
 		m.tab2.height = m.height
 		m.downloadM.width = m.width
@@ -190,8 +183,20 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		m.downloadM.subList.SetSize(40, 15)
 		m.downloadM.dubList.SetSize(40, 15)
+		m.downloadM.historyList.SetSize(82, 15)
 
 	case tea.KeyMsg:
+		if m.restorePrompt && m.currentScreen == AppScreen {
+			switch msg.String() {
+			case "y", "Y":
+				return m, m.answerRestorePrompt(true)
+			case "n", "N", "esc":
+				return m, m.answerRestorePrompt(false)
+			case "ctrl+c":
+				return m, tea.Quit
+			}
+			return m, nil
+		}
 		switch m.currentScreen {
 		case AppScreen:
 			switch msg.String() {
@@ -205,48 +210,43 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 
 				if len(m.downloadM.subList.Items()) == 0 && len(m.tab1.availableSubEpisodes) > 0 {
-					items := []list.Item{}
-					for _, episode := range m.tab1.availableSubEpisodes {
-						items = append(items, item{title: "Episode " + episode, style: "default"})
-					}
-					m.downloadM.subList.SetItems(items)
+					m.downloadM.subList.SetItems(m.tab1.episodeItems(m.tab1.availableSubEpisodes, "sub", episodeRange{}))
 				}
 
 				if len(m.downloadM.dubList.Items()) == 0 && len(m.tab1.availableDubEpisodes) > 0 {
-					items := []list.Item{}
-					for _, episode := range m.tab1.availableDubEpisodes {
-						items = append(items, item{title: "Episode " + episode, style: "default"})
-					}
-					m.downloadM.dubList.SetItems(items)
+					m.downloadM.dubList.SetItems(m.tab1.episodeItems(m.tab1.availableDubEpisodes, "dub", episodeRange{}))
 				}
 
 				if !m.downloadM.isRunning {
-					m.downloadM.isRunning = true
 					m.downloadM.percent = 0
-					return m, progressTick
 				}
 				return m, nil
 			case "tab":
-				if (m.currentTab == 0 && m.tab1.showHelpMenu) ||
-					(m.currentTab == 1 && m.tab2.showHelpMenu) {
+				if m.helpMenuOpen() {
 					break
 				}
-				m.currentTab = (m.currentTab + 1) % len(tabNames)
+				return m, m.switchTab((m.currentTab + 1) % len(tabNames))
 			case "ctrl+tab":
-				if (m.currentTab == 0 && m.tab1.showHelpMenu) ||
-					(m.currentTab == 1 && m.tab2.showHelpMenu) {
+				if m.helpMenuOpen() {
 					break
 				}
-				m.currentTab = (m.currentTab - 1 + len(tabNames)) % len(tabNames)
+				return m, m.switchTab((m.currentTab - 1 + len(tabNames)) % len(tabNames))
 			case "esc":
-				if (m.currentTab == 0 && m.tab1.showHelpMenu) ||
-					(m.currentTab == 1 && m.tab2.showHelpMenu) {
+				if m.helpMenuOpen() {
+					break
+				}
+				// esc closes the results filter bar or the episode jump prompt instead of quitting
+				if m.currentTab == watchTab && (m.tab1.focus == filterFocus || m.tab1.focus == jumpFocus) {
+					break
+				}
+				// esc answers "no" to a pending library delete
+				if m.currentTab == libraryTab && m.library.confirmDelete {
 					break
 				}
 				return m, tea.Quit
 			}
 			switch m.currentTab {
-			case 0:
+			case watchTab:
 				switch {
 				case key.Matches(msg, keys.Enter):
 					if m.tab1.focus == inputFocus {
@@ -254,6 +254,13 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						if searchTerm == "" {
 							return m, nil
 						}
+						m.tab1.recordSearch(searchTerm)
+						m.tab1.query = searchTerm
+						m.tab1.page = 1
+						m.tab1.hasNextPage = false
+						m.tab1.loadingMore = false
+						m.tab1.banner = ErrorBanner{}
+						m.tab1.retryPage = 0
 						m.tab1.loading = true
 						m.tab1.focus = tableFocus
 						m.tab1.data = [][]interface{}{}
@@ -263,7 +270,7 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.tab1.styles.list1Border = m.tab1.styles.list1Border.BorderForeground(gloss.Color(m.tab1.styles.inactiveColor))
 						m.tab1.styles.list2Border = m.tab1.styles.list2Border.BorderForeground(gloss.Color(m.tab1.styles.inactiveColor))
 						m.tab1.styles.tableBorder = m.tab1.styles.tableBorder.BorderForeground(gloss.Color(m.tab1.styles.activeColor))
-						return m, tea.Batch(m.tab1.fetchAnimeData(searchTerm), m.tab1.spinner.Tick)
+						return m, tea.Batch(m.tab1.fetchAnimeData(searchTerm, 1), m.tab1.spinner.Tick)
 					}
 				}
 
@@ -271,7 +278,11 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				updatedModel, cmd := m.tab1.Update(msg)
 				m.tab1 = updatedModel.(Tab1Model)
 				return m, cmd
-			case 1:
+			case libraryTab:
+				var cmd tea.Cmd
+				m.library, cmd = m.library.Update(msg)
+				return m, cmd
+			case aboutTab:
 				var cmd tea.Cmd
 				m.tab2, cmd = m.tab2.Update(msg)
 				return m, cmd
@@ -288,192 +299,82 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			case "ctrl+c":
 				if m.downloadM.isDownloading {
-					downloadCancelled = true
+					m.downloads.Cancel(m.downloadM.downloadID)
 					m.downloadM.downloadStatus = "Cancelling..."
-
-					return m, tea.Tick(time.Millisecond*300, func(t time.Time) tea.Msg {
-						return downloadCompleteMsg{err: fmt.Errorf("download cancelled by user")}
-					})
 				}
 				return m, nil
 			case "ctrl+p":
 				if m.downloadM.isDownloading {
-					downloadPaused = !downloadPaused
-					m.downloadM.isPaused = downloadPaused
+					m.downloadM.isPaused = !m.downloadM.isPaused
 					if m.downloadM.isPaused {
+						m.downloads.Pause(m.downloadM.downloadID)
 						m.downloadM.downloadStatus = "Paused"
 					} else {
+						m.downloads.Resume(m.downloadM.downloadID)
 						m.downloadM.downloadStatus = "Downloading..."
 					}
 					return m, nil
 				}
 				return m, nil
+			case "ctrl+s":
+				// start the queue now even though the download window is closed
+				if !m.downloadM.schedule.open {
+					m.downloads.Override(true)
+					m.downloadM.downloadStatus = "Starting downloads outside the download window..."
+				}
+				return m, nil
 			case "tab":
 				m.downloadM.focus = (m.downloadM.focus + 1) % 2
 				return m, nil
 			case "up", "down":
 				var cmd tea.Cmd
-				if m.downloadM.focus == subListFocus {
+				if m.downloadM.showHistory {
+					m.downloadM.historyList, cmd = m.downloadM.historyList.Update(msg)
+				} else if m.downloadM.focus == subListFocus {
 					m.downloadM.subList, cmd = m.downloadM.subList.Update(msg)
 				} else {
 					m.downloadM.dubList, cmd = m.downloadM.dubList.Update(msg)
 				}
 				return m, cmd
+			case "h":
+				m.downloadM.showHistory = !m.downloadM.showHistory
+				return m, nil
+			case "o":
+				if m.downloadM.showHistory {
+					if item, ok := m.downloadM.historyList.SelectedItem().(downloadRecordItem); ok && item.record.Path != "" {
+						if err := openContainingFolder(item.record.Path); err != nil {
+							m.downloadM.downloadError = fmt.Sprintf("could not open folder: %v", err)
+						}
+					}
+				}
+				return m, nil
 			case "enter":
-				if m.downloadM.isDownloading {
-					fmt.Println("Download in progress, ignoring new download request")
+				if m.downloadM.showHistory {
 					return m, nil
 				}
-
-				m.resetDownloadState()
-
-				select {
-				case <-downloadStatusCh:
-					fmt.Println("Discarded lingering message from download channel")
-				default:
+				episodeList := m.downloadM.subList
+				if m.downloadM.focus == dubListFocus {
+					episodeList = m.downloadM.dubList
 				}
-
-				if m.downloadM.focus == subListFocus && len(m.downloadM.subList.Items()) > 0 {
-					selectedItem := m.downloadM.subList.SelectedItem()
-					if selectedItem != nil {
-						episodeString := fmt.Sprintf("%s", selectedItem)
-						episodeNumber := ""
-
-						if strings.HasPrefix(episodeString, "⚆ Episode ") {
-							episodeString = strings.TrimPrefix(episodeString, "⚆ Episode ")
-						} else {
-							episodeString = strings.TrimPrefix(episodeString, "Episode ")
-						}
-
-						for _, char := range episodeString {
-							if char >= '0' && char <= '9' {
-								episodeNumber += string(char)
-							} else if episodeNumber != "" {
-								break
-							}
-						}
-
-						m.downloadM.selectedEpisode = episodeNumber
-						m.downloadM.episodeType = "sub"
-
-						link, err := getStreamLink(m.tab1.animeID, m.downloadM.episodeType, m.downloadM.selectedEpisode)
-						if err == nil && link != "" {
-							m.resetDownloadState()
-
-							m.downloadM.selectedEpisode = episodeNumber
-							m.downloadM.episodeType = "sub"
-							m.downloadM.streamLink = link
-							m.downloadM.showStreamLink = true
-
-							m.downloadM.isRunning = true
-							m.downloadM.isDownloading = true
-							m.downloadM.percent = 0
-							m.downloadM.downloadStatus = "Downloading..."
-							m.downloadM.downloadError = ""
-							showcase_filename := fmt.Sprintf("%s/%s_%s.mp4", m.tab1.animeName, m.downloadM.selectedEpisode, m.downloadM.episodeType)
-							m.DownloadFileName = showcase_filename
-
-							filename := fmt.Sprintf("%s_ep%s_%s.mp4", m.tab1.animeName, m.downloadM.selectedEpisode, m.downloadM.episodeType)
-
-							filename = strings.ReplaceAll(filename, " ", "_")
-							filename = strings.ReplaceAll(filename, ":", "")
-
-							m.DownloadFileName = filename
-							homeDIR, _ := os.UserHomeDir()
-							wd, _ := os.Getwd()
-							os.Mkdir(homeDIR+"/Videos/kaizen/"+m.tab1.animeName, 0755)
-
-							downloadCancelled = true
-							time.Sleep(100 * time.Millisecond)
-							downloadCancelled = false
-							downloadCmd := downloadFileCmd(link, homeDIR+"/Videos/kaizen/"+m.tab1.animeName, filename)
-
-							if conf.DownloadToWorkingDirectory == true {
-								downloadCmd = downloadFileCmd(link, wd, filename)
-							}
-							return m, downloadCmd
-						} else {
-							if err != nil {
-								m.downloadM.streamLink = fmt.Sprintf("Error: %v", err)
-							} else {
-								m.downloadM.streamLink = "Error: Could not fetch stream link"
-							}
-							m.downloadM.showStreamLink = true
-						}
-					}
-				} else if m.downloadM.focus == dubListFocus && len(m.downloadM.dubList.Items()) > 0 {
-					selectedItem := m.downloadM.dubList.SelectedItem()
-					if selectedItem != nil {
-						episodeString := fmt.Sprintf("%s", selectedItem)
-
-						episodeNumber := ""
-
-						if strings.HasPrefix(episodeString, "⚆ Episode ") {
-							episodeString = strings.TrimPrefix(episodeString, "⚆ Episode ")
-						} else {
-							episodeString = strings.TrimPrefix(episodeString, "Episode ")
-						}
-
-						for _, char := range episodeString {
-							if char >= '0' && char <= '9' {
-								episodeNumber += string(char)
-							} else if episodeNumber != "" {
-								break
-							}
-						}
-
-						m.downloadM.selectedEpisode = episodeNumber
-						m.downloadM.episodeType = "dub"
-
-						link, err := getStreamLink(m.tab1.animeID, m.downloadM.episodeType, m.downloadM.selectedEpisode)
-						if err == nil && link != "" {
-							m.resetDownloadState()
-
-							m.downloadM.selectedEpisode = episodeNumber
-							m.downloadM.episodeType = "dub"
-							m.downloadM.streamLink = link
-							m.downloadM.showStreamLink = true
-
-							m.downloadM.isRunning = true
-							m.downloadM.isDownloading = true
-							m.downloadM.percent = 0
-							m.downloadM.downloadStatus = "Downloading..."
-							m.downloadM.downloadError = ""
-							//showcase_filename := fmt.Sprintf("%s/%s_%s.mp4", m.tab1.animeName, m.downloadM.selectedEpisode, m.downloadM.episodeType)
-
-							filename := fmt.Sprintf("%s_ep%s_%s.mp4", m.tab1.animeName, m.downloadM.selectedEpisode, m.downloadM.episodeType)
-							filename = strings.ReplaceAll(filename, " ", "_")
-							filename = strings.ReplaceAll(filename, ":", "")
-
-							m.DownloadFileName = filename
-							homeDIR, _ := os.UserHomeDir()
-							os.Mkdir(homeDIR+"/Videos/kaizen/"+m.tab1.animeName, 0755)
-							wd, _ := os.Getwd()
-
-							downloadCancelled = true
-							time.Sleep(100 * time.Millisecond)
-							downloadCancelled = false
-
-							downloadCmd := downloadFileCmd(link, homeDIR+"/Videos/kaizen/"+m.tab1.animeName, filename)
-							if conf.DownloadToWorkingDirectory == true {
-								downloadCmd = downloadFileCmd(link, wd, filename)
-							}
-							return m, downloadCmd
-						} else {
-							if err != nil {
-								m.downloadM.streamLink = fmt.Sprintf("Error: %v", err)
-							} else {
-								m.downloadM.streamLink = "Error: Could not fetch stream link"
-							}
-							m.downloadM.showStreamLink = true
-						}
-					}
+				ref, ok := selectedEpisode(episodeList)
+				if !ok {
+					return m, nil
 				}
+				return m, m.queueDownload(ref)
 			}
 		}
-	case [][]interface{}:
-		m.tab1.data = msg
-		m.tab1.table.SetRows(m.tab1.generateRows(msg))
+	case searchPage:
+		// ignore pages that belong to an earlier search
+		if msg.query != m.tab1.query {
+			return m, nil
+		}
+		m.tab1.page = msg.page
+		titles := m.tab1.applySearchPage(msg)
+		m.tab1.recordSearch("", titles...)
+		if msg.page > 1 {
+			return m, nil
+		}
+
 		m.tab1.listOne.SetItems([]list.Item{item{title: "                         ", style: "none"}})
 		m.tab1.listTwo.SetItems([]list.Item{item{title: "                         ", style: "none"}})
 		m.tab1.listOne.SetShowStatusBar(false)
@@ -485,115 +386,91 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		m.downloadM.subList.SetItems([]list.Item{})
 		m.downloadM.dubList.SetItems([]list.Item{})
+	case libraryScannedMsg:
+		var cmd tea.Cmd
+		m.library, cmd = m.library.Update(msg)
+		return m, cmd
+	case streamProxyMsg:
+		m.tab1.showStreamProxy(msg)
+		return m, nil
+	case searchErrorMsg:
+		if msg.query != m.tab1.query {
+			return m, nil
+		}
+		m.tab1.showSearchError(msg)
+		return m, nil
 	case spinner.TickMsg:
 		if m.tab1.loading {
 			var cmd tea.Cmd
 			m.tab1.spinner, cmd = m.tab1.spinner.Update(msg)
 			return m, cmd
 		}
-	case progressTickMsg:
-		if m.downloadM.isDownloading {
-			select {
-			case update, ok := <-downloadStatusCh:
-				if ok {
-					if update.id == msg.downloadID || msg.downloadID == 0 {
-						m.downloadM.percent = update.progress
-
-						if update.complete {
-							if update.error != nil {
-								if strings.Contains(update.error.Error(), "superseded") {
-									m.downloadM.downloadStatus = "Starting new download..."
-									m.downloadM.downloadError = ""
-								} else {
-									m.downloadM.downloadStatus = "Download Failed"
-									m.downloadM.downloadError = update.error.Error()
-								}
-							} else {
-								m.downloadM.downloadStatus = "Download Complete!"
-								m.downloadM.downloadError = ""
-							}
-
-							m.downloadM.isRunning = false
-							m.downloadM.isDownloading = false
-							m.downloadM.isPaused = false
-
-							return m, nil
-						}
-					}
-				}
-			default:
+	case downloadUpdatesMsg:
+		cmds := []tea.Cmd{listenDownloads(m.downloads)}
+		for _, update := range msg {
+			if update.id == m.downloadM.downloadID && m.downloadM.isDownloading {
+				cmds = append(cmds, m.applyDownloadUpdate(update))
 			}
-
-			return m, tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
-				return progressTickMsg{downloadID: msg.downloadID}
-			})
-		} else if m.downloadM.isRunning {
-			if m.downloadM.percent >= 1.0 {
-				m.downloadM.percent = 1.0
-				m.downloadM.isRunning = false
-				return m, nil
-			}
-			return m, tea.Tick(time.Millisecond*100, func(t time.Time) tea.Msg {
-				return progressTickMsg{downloadID: 0}
-			})
-		}
-	case AnimeSelectedMsg:
-		items := []list.Item{}
-		for _, episode := range msg.AvailableSubEpisodes {
-			items = append(items, item{title: "Episode " + episode, style: "default"})
 		}
-		m.downloadM.subList.SetItems(items)
-
-		items = []list.Item{}
-		for _, episode := range msg.AvailableDubEpisodes {
-			items = append(items, item{title: "Episode " + episode, style: "default"})
+		return m, tea.Batch(cmds...)
+	case downloadResolvedMsg:
+		return m, m.beginDownload(msg)
+	case downloadScheduleMsg:
+		m.downloadM.schedule = downloadSchedule(msg)
+		cmds := []tea.Cmd{listenDownloadSchedule(m.downloads)}
+		if m.downloadM.schedule.open && !m.downloadM.isDownloading && !m.downloadM.resolving {
+			cmds = append(cmds, m.startNextDownload())
 		}
-		m.downloadM.dubList.SetItems(items)
-
-		return m, nil
-	case downloadProgressMsg:
-		m.downloadM.percent = msg.percent
+		return m, tea.Batch(cmds...)
+	case downloadHookMsg:
 		if msg.err != nil {
-			m.downloadM.downloadStatus = "Download Cancelled"
 			m.downloadM.downloadError = msg.err.Error()
-			m.downloadM.isDownloading = false
 		}
 		return m, nil
-
-	case downloadCompleteMsg:
+	case mediaMetadataMsg:
 		if msg.err != nil {
-			if strings.Contains(msg.err.Error(), "superseded") {
-				m.downloadM.downloadStatus = "Starting new download..."
-				m.downloadM.downloadError = ""
-			} else {
-				m.downloadM.downloadStatus = "Download Cancelled"
-				m.downloadM.downloadError = msg.err.Error()
-			}
-		} else {
-			m.downloadM.downloadStatus = "Download Complete!"
-			m.downloadM.downloadError = ""
-		}
-
-		statusMessage := m.downloadM.downloadStatus
-		errorMessage := m.downloadM.downloadError
-
-		if !strings.Contains(statusMessage, "Starting new download") {
-			m.resetDownloadState()
-
-			m.downloadM.downloadStatus = statusMessage
-			m.downloadM.downloadError = errorMessage
+			m.downloadM.downloadError = fmt.Sprintf("could not write media server metadata: %v", msg.err)
 		}
+		return m, nil
+	case AnimeSelectedMsg:
+		m.downloadM.subList.SetItems(m.tab1.episodeItems(msg.AvailableSubEpisodes, "sub", episodeRange{}))
+		m.downloadM.dubList.SetItems(m.tab1.episodeItems(msg.AvailableDubEpisodes, "dub", episodeRange{}))
 
 		return m, nil
 	}
 	return m, nil
 }
 
+// helpMenuOpen reports whether the current tab is showing the help menu
+func (m MainModel) helpMenuOpen() bool {
+	switch m.currentTab {
+	case watchTab:
+		return m.tab1.showHelpMenu
+	case libraryTab:
+		return m.library.showHelpMenu
+	case aboutTab:
+		return m.tab2.showHelpMenu
+	}
+	return false
+}
+
+// switchTab makes tab current and returns the rescan of the library when it is opened
+func (m *MainModel) switchTab(tab int) tea.Cmd {
+	m.currentTab = tab
+	if tab == libraryTab {
+		return m.library.Refresh()
+	}
+	return nil
+}
+
 // View renders the current screen based on the AppState.
 // Returns: A string representing the current screen's content.
 func (m MainModel) View() string {
 	switch m.currentScreen {
 	case AppScreen:
+		if m.restorePrompt {
+			return ClearKittyImage() + m.restorePromptView()
+		}
 		var tabs []string
 		for i, name := range tabNames {
 			if i == m.currentTab {
@@ -607,11 +484,14 @@ func (m MainModel) View() string {
 		tabsRow = gloss.JoinHorizontal(gloss.Bottom, tabsRow, gloss.NewStyle().Foreground(DefaultActiveTabIndicatorColor).Render(strings.Repeat("─", m.width)))
 		content := ""
 		switch m.currentTab {
-		case 0:
+		case watchTab:
 			m.tab1.width = m.width
 			m.tab1.focus = inputFocus
 			content = m.tab1.View()
-		case 1:
+		case libraryTab:
+			// Clear thumbnail image when switching away from Watch Anime
+			content = ClearKittyImage() + m.library.View()
+		case aboutTab:
 			// Clear thumbnail image when switching to About tab
 			content = ClearKittyImage() + m.tab2.View()
 		}
@@ -683,6 +563,14 @@ Please resize the window to either full screen or reduce the text size of the wi
 			}
 		}
 
+		queued := m.downloadM.history.Queued()
+		if !m.downloadM.schedule.open && (m.downloadM.isDownloading || queued > 0) {
+			status = m.downloadM.schedule.waitingLabel()
+		}
+		if queued > 0 {
+			status += fmt.Sprintf(" • %d queued", queued)
+		}
+
 		statusStyle := gloss.NewStyle().
 			Foreground(gloss.Color("#FFFFFF")).
 			Background(gloss.Color("#333333")).
@@ -691,14 +579,7 @@ Please resize the window to either full screen or reduce the text size of the wi
 			Width(m.width - 20).
 			Align(gloss.Left)
 
-		homeDIR, _ := os.UserHomeDir()
-		wd, _ := os.Getwd()
-		downloadDir := "error"
-		if conf.DownloadToWorkingDirectory == true {
-			downloadDir = wd
-		} else {
-			downloadDir = homeDIR + "/Videos/kaizen"
-		}
+		downloadDir := libraryRoot()
 		animeInfo := []string{
 			labelStyle.Render("Anime: ") + valueStyle.Render(m.tab1.animeName),
 			labelStyle.Render("Rating: ") + valueStyle.Render(m.tab1.rating),
@@ -728,7 +609,7 @@ Please resize the window to either full screen or reduce the text size of the wi
 		TipsRow := "\n" + valueStyle.Render("Tips:") + "\n" +
 			valueStyle.Render("• Press ESC to return back to app") + "\n" +
 			valueStyle.Render("• Select an anime from the search table in app to download its episodes") + "\n" +
-			valueStyle.Render("• Select an episode from the lists below and press ENTER to start the download") + "\n" +
+			valueStyle.Render("• Select an episode from the lists below and press ENTER to download it, or queue it behind the current one") + "\n" +
 			valueStyle.Render("• You can still go back to app while the download continues in background")
 
 		animeInfoSection := infoBox.Render(
@@ -736,33 +617,39 @@ Please resize the window to either full screen or reduce the text size of the wi
 
 		progressDisplay := m.downloadM.progress.ViewAs(m.downloadM.percent)
 
+		retriesLabel := ""
+		if m.downloadM.retries > 0 {
+			retriesLabel = fmt.Sprintf("  (retry %d/%d)", m.downloadM.retries, conf.DownloadRetries)
+		}
+
 		progressSection := gloss.NewStyle().
 			PaddingTop(1).
 			Width(m.width - 20).
 			Align(gloss.Left).
-			Render(progressDisplay + "\n\n" + "Currently Processing: " + m.DownloadFileName)
+			Render(progressDisplay + "\n\n" + "Currently Processing: " + m.DownloadFileName + retriesLabel)
 
 		// Update the lists with the available episodes
 		if len(m.downloadM.subList.Items()) == 0 && len(m.tab1.availableSubEpisodes) > 0 {
-			items := []list.Item{}
-			for _, episode := range m.tab1.availableSubEpisodes {
-				items = append(items, item{title: "Episode " + episode, style: "default"})
-			}
-			m.downloadM.subList.SetItems(items)
+			m.downloadM.subList.SetItems(m.tab1.episodeItems(m.tab1.availableSubEpisodes, "sub", episodeRange{}))
 		}
 
 		if len(m.downloadM.dubList.Items()) == 0 && len(m.tab1.availableDubEpisodes) > 0 {
-			items := []list.Item{}
-			for _, episode := range m.tab1.availableDubEpisodes {
-				items = append(items, item{title: "Episode " + episode, style: "default"})
-			}
-			m.downloadM.dubList.SetItems(items)
+			m.downloadM.dubList.SetItems(m.tab1.episodeItems(m.tab1.availableDubEpisodes, "dub", episodeRange{}))
 		}
 
 		subListView := subListStyle.Render(m.downloadM.subList.View())
 		dubListView := dubListStyle.Render(m.downloadM.dubList.View())
 
 		episodeLists := gloss.JoinHorizontal(gloss.Top, subListView, dubListView)
+		if m.downloadM.showHistory {
+			episodeLists = gloss.NewStyle().
+				Border(gloss.RoundedBorder()).
+				BorderForeground(gloss.Color(conf.Tab1FocusActive)).
+				Padding(1).
+				Width(82).
+				Align(gloss.Left).
+				Render(m.downloadM.historyList.View())
+		}
 
 		episodeListsSection := gloss.NewStyle().
 			Align(gloss.Left).
@@ -780,14 +667,19 @@ Please resize the window to either full screen or reduce the text size of the wi
 		}
 
 		controls := ""
-		if m.downloadM.isDownloading {
+		if m.downloadM.showHistory {
+			controls = "O to open the containing folder, H to go back to the episode lists, ESC to return"
+		} else if m.downloadM.isDownloading {
 			if m.downloadM.isPaused {
-				controls = "Ctrl+P to Resume, Ctrl+C to Cancel, ESC to exit"
+				controls = "Ctrl+P to Resume, Ctrl+C to Cancel, ENTER to queue, H for history, ESC to exit"
 			} else {
-				controls = "Ctrl+P to Pause, Ctrl+C to Cancel, ESC to exit"
+				controls = "Ctrl+P to Pause, Ctrl+C to Cancel, ENTER to queue, H for history, ESC to exit"
 			}
 		} else {
-			controls = "Press TAB to switch between lists, ESC to return"
+			controls = "Press TAB to switch between lists, H for download history, ESC to return"
+		}
+		if !m.downloadM.schedule.open && !m.downloadM.showHistory {
+			controls = "Ctrl+S to start now, " + controls
 		}
 
 		controlsDisplay := gloss.NewStyle().
@@ -820,201 +712,78 @@ Please resize the window to either full screen or reduce the text size of the wi
 	return ""
 }
 
-func downloadFileCmd(url, savePath, filename string) tea.Cmd {
-	downloadID++
-	currentID := downloadID
-
-	downloadPaused = false
-	downloadCancelled = false
-
-	downloadStatusCh <- downloadStatusUpdate{
-		id:       currentID,
-		progress: 0.0,
-		complete: false,
-		error:    nil,
-	}
-
-	go downloadFile(currentID, url, savePath, filename)
+func (m *MainModel) resetDownloadState() {
 
-	return func() tea.Msg {
-		return progressTickMsg{downloadID: currentID}
-	}
+	m.downloadM.percent = 0.0
+	m.downloadM.isRunning = false
+	m.downloadM.isDownloading = false
+	m.downloadM.isPaused = false
+	m.downloadM.downloadStatus = "Ready"
+	m.downloadM.streamLink = ""
+	m.downloadM.showStreamLink = false
+	m.downloadM.downloadError = ""
+	m.downloadM.selectedEpisode = ""
+	m.downloadM.retries = 0
+	m.DownloadFileName = ""
 }
 
-func downloadFile(id int, url, savePath, filename string) {
-
-	if err := os.MkdirAll(savePath, 0755); err != nil {
-		downloadStatusCh <- downloadStatusUpdate{
-			id:       id,
-			progress: 0,
-			complete: true,
-			error:    fmt.Errorf("failed to create directory: %v", err),
-		}
-		return
-	}
-
-	fullPath := filepath.Join(savePath, filename)
-	file, err := os.Create(fullPath)
-	if err != nil {
-		downloadStatusCh <- downloadStatusUpdate{
-			id:       id,
-			progress: 0,
-			complete: true,
-			error:    fmt.Errorf("failed to create file: %v", err),
-		}
-		return
-	}
-	defer file.Close()
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		downloadStatusCh <- downloadStatusUpdate{
-			id:       id,
-			progress: 0,
-			complete: true,
-			error:    fmt.Errorf("failed to create request: %v", err),
+// applyDownloadUpdate shows a progress or completion update of the current download
+func (m *MainModel) applyDownloadUpdate(update downloadStatusUpdate) tea.Cmd {
+	m.downloadM.percent = update.progress
+	if update.retries != m.downloadM.retries {
+		m.downloadM.retries = update.retries
+		if record, ok := m.downloadM.history.Get(m.downloadM.jobKey); ok {
+			record.Retries = update.retries
 		}
-		return
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		downloadStatusCh <- downloadStatusUpdate{
-			id:       id,
-			progress: 0,
-			complete: true,
-			error:    fmt.Errorf("failed to fetch URL: %v", err),
-		}
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		downloadStatusCh <- downloadStatusUpdate{
-			id:       id,
-			progress: 0,
-			complete: true,
-			error:    fmt.Errorf("bad status: %s", resp.Status),
-		}
-		return
-	}
-
-	totalSize := resp.ContentLength
-
-	var downloaded int64
-	buf := make([]byte, 32*1024)
-	lastUpdateTime := time.Now()
-
-	for {
-		if downloadCancelled && downloadID == id {
-			downloadStatusCh <- downloadStatusUpdate{
-				id:       id,
-				progress: float64(downloaded) / float64(totalSize),
-				complete: true,
-				error:    fmt.Errorf("download cancelled by user"),
-			}
-			return
-		}
-
-		if downloadPaused && downloadID == id {
-			time.Sleep(100 * time.Millisecond)
-			continue
-		}
-
-		if downloadID != id {
-			downloadStatusCh <- downloadStatusUpdate{
-				id:       id,
-				progress: float64(downloaded) / float64(totalSize),
-				complete: true,
-				error:    fmt.Errorf("download superseded by a new download"),
-			}
-			return
-		}
-
-		n, err := resp.Body.Read(buf)
-		if n > 0 {
-			_, writeErr := file.Write(buf[:n])
-			if writeErr != nil {
-				downloadStatusCh <- downloadStatusUpdate{
-					id:       id,
-					progress: float64(downloaded) / float64(totalSize),
-					complete: true,
-					error:    fmt.Errorf("failed to write to file: %v", writeErr),
-				}
-				return
-			}
-
-			downloaded += int64(n)
-
-			if time.Since(lastUpdateTime) > 100*time.Millisecond {
-				var progress float64
-				if totalSize > 0 {
-					progress = float64(downloaded) / float64(totalSize)
-				} else {
-					progress = 0.5
-				}
-
-				select {
-				case downloadStatusCh <- downloadStatusUpdate{
-					id:       id,
-					progress: progress,
-					complete: false,
-				}:
-				default:
-					fmt.Printf("Download #%d: Channel full, skipping update\n", id)
-				}
-
-				lastUpdateTime = time.Now()
-			}
-		}
-
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			downloadStatusCh <- downloadStatusUpdate{
-				id:       id,
-				progress: float64(downloaded) / float64(totalSize),
-				complete: true,
-				error:    fmt.Errorf("error reading response: %v", err),
-			}
-			return
+	if !update.complete {
+		if update.error != nil {
+			// a failed attempt that will be retried
+			m.downloadM.downloadStatus = fmt.Sprintf("Retrying (%d/%d)...", update.retries, conf.DownloadRetries)
+			m.downloadM.downloadError = update.error.Error()
+		} else if m.downloadM.retries > 0 && !m.downloadM.isPaused {
+			m.downloadM.downloadStatus = "Downloading..."
+			m.downloadM.downloadError = ""
 		}
+		return nil
 	}
 
-	downloadStatusCh <- downloadStatusUpdate{
-		id:       id,
-		progress: 1.0,
-		complete: true,
-		filePath: fullPath,
-		error:    nil,
+	switch {
+	case update.error == nil:
+		m.downloadM.downloadStatus = "Download Complete!"
+		m.downloadM.downloadError = ""
+	case errors.Is(update.error, errDownloadSuperseded):
+		m.downloadM.downloadStatus = "Starting new download..."
+		m.downloadM.downloadError = ""
+	case errors.Is(update.error, errDownloadCancelled):
+		m.downloadM.downloadStatus = "Download Cancelled"
+		m.downloadM.downloadError = update.error.Error()
+	default:
+		m.downloadM.downloadStatus = "Download Failed"
+		m.downloadM.downloadError = update.error.Error()
 	}
-}
 
-var downloadStatusCh = make(chan downloadStatusUpdate, 100) // Increased buffer size
-
-func (m *MainModel) resetDownloadState() {
-
-	m.downloadM.percent = 0.0
 	m.downloadM.isRunning = false
 	m.downloadM.isDownloading = false
 	m.downloadM.isPaused = false
-	m.downloadM.downloadStatus = "Ready"
-	m.downloadM.streamLink = ""
-	m.downloadM.showStreamLink = false
-	m.downloadM.downloadError = ""
-	m.downloadM.selectedEpisode = ""
-	m.DownloadFileName = ""
 
-	downloadPaused = false
-	downloadCancelled = false
+	m.downloadM.history.Finish(m.downloadM.jobKey, update.downloaded, update.total, update.error)
+	m.downloadM.history.Save() //nolint:errcheck
+	m.refreshHistoryList()
 
-	for {
-		select {
-		case <-downloadStatusCh:
-		default:
-			return
+	var cmds []tea.Cmd
+	if !isDownloadCancellation(update.error) {
+		job := m.downloadM.job
+		if update.filePath != "" {
+			job.path = update.filePath
 		}
+		cmds = append(cmds, downloadEventCmd(downloadEvent{job: job, err: update.error}))
+	}
+	if media := m.downloadM.media; media != nil && update.error == nil {
+		m.downloadM.media = nil
+		media.videoPath = update.filePath
+		cmds = append(cmds, writeMediaMetadataCmd(*media))
 	}
+	cmds = append(cmds, m.continueQueue())
+	return tea.Batch(cmds...)
 }
@@ -0,0 +1,223 @@
+package src
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+/*
+mediaInfo is what the media server layout needs to describe a finished download:
+the anime's metadata, the episode and where the show and video were saved.
+*/
+type mediaInfo struct {
+	anime     Anime
+	ref       EpisodeRef
+	showDir   string
+	videoPath string
+}
+
+// mediaMetadataMsg reports the result of writing the NFO files and poster
+type mediaMetadataMsg struct {
+	err error
+}
+
+// animeFromRow rebuilds the Anime a search result row was made from
+func animeFromRow(row []any) Anime {
+	var genres []string
+	if colGenres < len(row) {
+		genres, _ = row[colGenres].([]string)
+	}
+	return Anime{
+		ID:          rowString(row, colID),
+		Title:       rowString(row, colTitle),
+		Thumbnail:   rowString(row, colThumbnail),
+		SubCount:    rowFloat(row, colSubCount),
+		DubCount:    rowFloat(row, colDubCount),
+		EnglishName: rowString(row, colEnglishName),
+		Description: rowString(row, colDescription),
+		Genres:      genres,
+		Status:      rowString(row, colStatus),
+		Type:        rowString(row, colType),
+		Rating:      rowString(row, colRating),
+		Score:       rowFloat(row, colScore),
+	}
+}
+
+// animeByID returns the metadata of a search result by its anime ID
+func (m Tab1Model) animeByID(id string) (Anime, bool) {
+	for _, row := range m.data {
+		if rowString(row, colID) == id {
+			return animeFromRow(row), true
+		}
+	}
+	return Anime{}, false
+}
+
+// tvShowNFO is the tvshow.nfo document read by Jellyfin, Plex (with an NFO agent) and Kodi
+type tvShowNFO struct {
+	XMLName       xml.Name    `xml:"tvshow"`
+	Title         string      `xml:"title"`
+	OriginalTitle string      `xml:"originaltitle,omitempty"`
+	Plot          string      `xml:"plot,omitempty"`
+	Genres        []string    `xml:"genre"`
+	MPAA          string      `xml:"mpaa,omitempty"`
+	Rating        *nfoRatings `xml:"ratings,omitempty"`
+	Status        string      `xml:"status,omitempty"`
+	UniqueID      nfoUniqueID `xml:"uniqueid"`
+}
+
+type nfoRatings struct {
+	Rating struct {
+		Name    string  `xml:"name,attr"`
+		Max     int     `xml:"max,attr"`
+		Default bool    `xml:"default,attr"`
+		Value   float64 `xml:"value"`
+	} `xml:"rating"`
+}
+
+type nfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr"`
+	Value   string `xml:",chardata"`
+}
+
+// episodeNFO is the <video>.nfo document describing a single episode
+type episodeNFO struct {
+	XMLName   xml.Name    `xml:"episodedetails"`
+	Title     string      `xml:"title"`
+	ShowTitle string      `xml:"showtitle"`
+	Season    int         `xml:"season"`
+	Episode   string      `xml:"episode,omitempty"`
+	UniqueID  nfoUniqueID `xml:"uniqueid"`
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// newTVShowNFO builds the show NFO from the anime metadata
+func newTVShowNFO(anime Anime) tvShowNFO {
+	nfo := tvShowNFO{
+		Title:    anime.Title,
+		Plot:     strings.TrimSpace(htmlTag.ReplaceAllString(anime.Description, "")),
+		Genres:   anime.Genres,
+		MPAA:     anime.Rating,
+		Status:   anime.Status,
+		UniqueID: nfoUniqueID{Type: "kaizen", Default: true, Value: anime.ID},
+	}
+	if anime.EnglishName != "" && anime.EnglishName != anime.Title {
+		nfo.Title = anime.EnglishName
+		nfo.OriginalTitle = anime.Title
+	}
+	switch strings.ToLower(anime.Status) {
+	case "releasing", "ongoing":
+		nfo.Status = "Continuing"
+	case "finished", "completed":
+		nfo.Status = "Ended"
+	}
+	if anime.Score > 0 {
+		nfo.Rating = &nfoRatings{}
+		nfo.Rating.Rating.Name = "kaizen"
+		nfo.Rating.Rating.Max = 10
+		nfo.Rating.Rating.Default = true
+		nfo.Rating.Rating.Value = anime.Score
+	}
+	return nfo
+}
+
+// newEpisodeNFO builds the NFO for one episode; fractional and special episodes carry no episode number
+func newEpisodeNFO(anime Anime, ref EpisodeRef) episodeNFO {
+	nfo := episodeNFO{
+		Title:     ref.Label(),
+		ShowTitle: anime.Title,
+		Season:    1,
+		UniqueID:  nfoUniqueID{Type: "kaizen", Default: true, Value: fmt.Sprintf("%s-%s-%s", anime.ID, ref.Type, ref.ID)},
+	}
+	if anime.EnglishName != "" {
+		nfo.ShowTitle = anime.EnglishName
+	}
+	if !ref.Special && ref.Number == float64(int(ref.Number)) {
+		nfo.Episode = strconv.Itoa(int(ref.Number))
+	}
+	if ref.Type == "dub" {
+		nfo.Title += " (Dub)"
+	}
+	return nfo
+}
+
+// writeNFO writes v as an indented XML document
+func writeNFO(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+/*
+writeMediaMetadata writes tvshow.nfo and poster.jpg into the show directory and an
+NFO next to the episode video. The show NFO is refreshed on every download; an
+existing poster is kept.
+*/
+func writeMediaMetadata(ctx context.Context, info mediaInfo) error {
+	if err := os.MkdirAll(info.showDir, 0755); err != nil {
+		return err
+	}
+	if err := writeNFO(filepath.Join(info.showDir, "tvshow.nfo"), newTVShowNFO(info.anime)); err != nil {
+		return err
+	}
+
+	episodePath := strings.TrimSuffix(info.videoPath, filepath.Ext(info.videoPath)) + ".nfo"
+	if err := writeNFO(episodePath, newEpisodeNFO(info.anime, info.ref)); err != nil {
+		return err
+	}
+
+	poster := filepath.Join(info.showDir, "poster.jpg")
+	if _, err := os.Stat(poster); err == nil || info.anime.Thumbnail == "" {
+		return nil
+	}
+	return downloadPoster(ctx, info.anime.Thumbnail, poster)
+}
+
+// downloadPoster saves the thumbnail at url to path
+func downloadPoster(ctx context.Context, url, path string) error {
+	resp, err := apiClient.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("poster: bad status: %s", resp.Status)
+	}
+
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmp) //nolint:errcheck
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeMediaMetadataCmd writes the media server metadata in the background
+func writeMediaMetadataCmd(info mediaInfo) tea.Cmd {
+	return func() tea.Msg {
+		return mediaMetadataMsg{err: writeMediaMetadata(appCtx, info)}
+	}
+}
@@ -0,0 +1,103 @@
+package src
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaServerTemplate(t *testing.T) {
+	tmpl, err := parseFilenameTemplate(mediaServerTemplate)
+	assert.NoError(t, err)
+
+	sub := tmpl.Render(templateValues{Title: "Frieren", Ref: EpisodeRef{ID: "5", Type: "sub"}, Ext: "mp4"})
+	dub := tmpl.Render(templateValues{Title: "Frieren", Ref: EpisodeRef{ID: "5", Type: "dub"}, Ext: "mp4"})
+	assert.Equal(t, "Frieren/Season 01/Frieren - S01E05.mp4", sub)
+	assert.Equal(t, "Frieren/Season 01/Frieren - S01E05 [dub].mp4", dub)
+
+	root := t.TempDir()
+	for _, rel := range []string{sub, dub} {
+		name, ref, ok := parseLibraryFile(root, filepath.Join(root, filepath.FromSlash(rel)), tmpl.Pattern())
+		assert.True(t, ok, rel)
+		assert.Equal(t, "Frieren", name)
+		assert.Equal(t, "5", ref.ID)
+	}
+	_, ref, _ := parseLibraryFile(root, filepath.Join(root, filepath.FromSlash(dub)), tmpl.Pattern())
+	assert.Equal(t, "dub", ref.Type)
+}
+
+func TestWriteMediaMetadata(t *testing.T) {
+	defaultClient := apiClient
+	apiClient = newTestHTTPClient(0)
+	defer func() { apiClient = defaultClient }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jpeg")) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	showDir := filepath.Join(t.TempDir(), "Frieren")
+	video := filepath.Join(showDir, "Season 01", "Frieren - S01E05.mp4")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(video), 0755))
+
+	anime := Anime{
+		ID:          "abc",
+		Title:       "Sousou no Frieren",
+		EnglishName: "Frieren: Beyond Journey's End",
+		Description: "An elf <br>mage & her friends.",
+		Genres:      []string{"Adventure", "Fantasy"},
+		Status:      "Finished",
+		Rating:      "PG-13",
+		Score:       9.1,
+		Thumbnail:   server.URL + "/cover.jpg",
+	}
+	info := mediaInfo{anime: anime, ref: EpisodeRef{ID: "5", Type: "sub", Number: 5}, showDir: showDir, videoPath: video}
+	assert.NoError(t, writeMediaMetadata(context.Background(), info))
+
+	show, err := os.ReadFile(filepath.Join(showDir, "tvshow.nfo"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(show), "<title>Frieren: Beyond Journey&#39;s End</title>")
+	assert.Contains(t, string(show), "<originaltitle>Sousou no Frieren</originaltitle>")
+	assert.Contains(t, string(show), "<plot>An elf mage &amp; her friends.</plot>")
+	assert.Contains(t, string(show), "<genre>Fantasy</genre>")
+	assert.Contains(t, string(show), "<status>Ended</status>")
+	assert.Contains(t, string(show), "<value>9.1</value>")
+
+	episode, err := os.ReadFile(filepath.Join(showDir, "Season 01", "Frieren - S01E05.nfo"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(episode), "<season>1</season>")
+	assert.Contains(t, string(episode), "<episode>5</episode>")
+
+	poster, err := os.ReadFile(filepath.Join(showDir, "poster.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", string(poster))
+}
+
+func TestScanLibraryIgnoresMediaSidecars(t *testing.T) {
+	defaultConf := conf
+	conf.MediaServerLayout = true
+	defer func() { conf = defaultConf }()
+
+	root := t.TempDir()
+	season := filepath.Join(root, "Frieren", "Season 01")
+	writeLibraryFile(t, filepath.Join(season, "Frieren - S01E05.mp4"), 100)
+	writeLibraryFile(t, filepath.Join(season, "Frieren - S01E05.nfo"), 10)
+	writeLibraryFile(t, filepath.Join(season, "Frieren - S01E06.mp4"+partialSuffix), 50)
+	writeLibraryFile(t, filepath.Join(season, "Frieren - S01E06.mp4"+partialSuffix+segmentStateSuffix), 10)
+	writeLibraryFile(t, filepath.Join(season, "Frieren - S01E07.5 [dub].mkv"), 100)
+	writeLibraryFile(t, filepath.Join(root, "Frieren", "tvshow.nfo"), 10)
+
+	shows, err := scanLibrary(root)
+	assert.NoError(t, err)
+	if assert.Len(t, shows, 1) && assert.Len(t, shows[0].episodes, 2) {
+		assert.Equal(t, "5", shows[0].episodes[0].ref.ID)
+		assert.Equal(t, "7.5", shows[0].episodes[1].ref.ID)
+		assert.Equal(t, "dub", shows[0].episodes[1].ref.Type)
+		assert.EqualValues(t, 200, shows[0].size)
+	}
+}
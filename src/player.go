@@ -0,0 +1,109 @@
+package src
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// supported Player.Name values
+const (
+	playerMpv    = "mpv"
+	playerVLC    = "vlc"
+	playerCustom = "custom"
+)
+
+/*
+playerCommand returns the command line that plays stream, titled title, with the
+player configured in c. stream is either a resolved episode stream, whose headers the
+player has to send, or a downloaded file without any.
+*/
+func playerCommand(c Config, stream StreamDescriptor, title string) ([]string, error) {
+	switch strings.ToLower(strings.TrimSpace(c.PlayerName)) {
+	case "", playerMpv:
+		args := append([]string{"mpv"}, mpvNetworkArgs(c, stream)...)
+		args = append(args, c.PlayerMpvArgs...)
+		return append(args, stream.URL, "--force-media-title="+title), nil
+	case playerVLC:
+		args := append([]string{"vlc", "--play-and-exit", "--meta-title=" + title}, vlcNetworkArgs(c, stream)...)
+		args = append(args, c.PlayerVlcArgs...)
+		return append(args, stream.URL), nil
+	case playerCustom:
+		return customPlayerCommand(c.PlayerCommand, stream, title)
+	}
+	return nil, fmt.Errorf("unknown Player.Name %q: use mpv, vlc or custom", c.PlayerName)
+}
+
+/*
+vlcNetworkArgs is the VLC counterpart of mpvNetworkArgs. VLC cannot send arbitrary
+headers, so only the Referer and User-Agent are passed on, along with an http(s) proxy.
+*/
+func vlcNetworkArgs(c Config, stream StreamDescriptor) []string {
+	var args []string
+	if referer := stream.Headers.Get("Referer"); referer != "" {
+		args = append(args, "--http-referrer="+referer)
+	}
+	if ua := stream.Headers.Get("User-Agent"); ua != "" {
+		args = append(args, "--http-user-agent="+ua)
+	}
+	if proxyURL, err := parseProxyURL(c.NetworkProxy); err == nil && proxyURL != nil &&
+		(proxyURL.Scheme == "http" || proxyURL.Scheme == "https") {
+		args = append(args, "--http-proxy="+proxyURL.String())
+	}
+	return args
+}
+
+/*
+customPlayerCommand fills in the Player.Command template. The template is split into
+arguments on spaces before the {url}, {title}, {referer} and {user_agent} placeholders
+are replaced, so values containing spaces stay one argument and need no quoting. The
+URL is appended when the template has no {url}.
+*/
+func customPlayerCommand(template string, stream StreamDescriptor, title string) ([]string, error) {
+	args := strings.Fields(template)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Player.Command is empty")
+	}
+	placeholders := strings.NewReplacer(
+		"{url}", stream.URL,
+		"{title}", title,
+		"{referer}", stream.Headers.Get("Referer"),
+		"{user_agent}", stream.Headers.Get("User-Agent"),
+	)
+	for i, arg := range args {
+		args[i] = placeholders.Replace(arg)
+	}
+	if !strings.Contains(template, "{url}") {
+		args = append(args, stream.URL)
+	}
+	return args, nil
+}
+
+/*
+CheckPlayer reports whether the configured player is installed. Only playback needs
+it, so a missing player is a warning rather than a reason not to start.
+*/
+func CheckPlayer() error {
+	args, err := playerCommand(conf, StreamDescriptor{}, "")
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("%s was not found: install it or change Player in config.yaml to play episodes", args[0])
+	}
+	return nil
+}
+
+// playStream plays stream in the configured player and waits until it is closed
+func playStream(stream StreamDescriptor, title string) error {
+	args, err := playerCommand(conf, stream, title)
+	if err != nil {
+		return err
+	}
+	player := exec.CommandContext(appCtx, args[0], args[1:]...)
+	if _, err := player.Output(); err != nil {
+		return fmt.Errorf("%s failed: %v", filepath.Base(args[0]), err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package src
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testStream = StreamDescriptor{
+	URL:     "https://cdn.example.com/ep1.mp4",
+	Headers: http.Header{"Referer": {"https://example.com/"}, "User-Agent": {"Mozilla/5.0"}},
+}
+
+func TestPlayerCommandMpv(t *testing.T) {
+	args, err := playerCommand(Config{PlayerName: "mpv", PlayerMpvArgs: []string{"--volume=50"}}, testStream, "Show Episode 1 (SUB)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"mpv",
+		"--http-header-fields-append=Referer: https://example.com/",
+		"--user-agent=Mozilla/5.0",
+		"--volume=50",
+		"https://cdn.example.com/ep1.mp4",
+		"--force-media-title=Show Episode 1 (SUB)",
+	}, args)
+
+	args, err = playerCommand(Config{}, StreamDescriptor{URL: "/videos/ep1.mp4"}, "Show")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mpv", "/videos/ep1.mp4", "--force-media-title=Show"}, args, "mpv is the default and extra args are optional")
+}
+
+func TestPlayerCommandVLC(t *testing.T) {
+	args, err := playerCommand(Config{PlayerName: "VLC", PlayerVlcArgs: []string{"--fullscreen"}, NetworkProxy: "http://proxy:8080"}, testStream, "Show")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"vlc", "--play-and-exit", "--meta-title=Show",
+		"--http-referrer=https://example.com/",
+		"--http-user-agent=Mozilla/5.0",
+		"--http-proxy=http://proxy:8080",
+		"--fullscreen",
+		"https://cdn.example.com/ep1.mp4",
+	}, args)
+}
+
+func TestPlayerCommandCustom(t *testing.T) {
+	c := Config{PlayerName: "custom", PlayerCommand: "iina --mpv-referrer={referer} --mpv-user-agent={user_agent} --mpv-force-media-title={title} {url}"}
+	args, err := playerCommand(c, testStream, "Show Episode 1 (SUB)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"iina",
+		"--mpv-referrer=https://example.com/",
+		"--mpv-user-agent=Mozilla/5.0",
+		"--mpv-force-media-title=Show Episode 1 (SUB)",
+		"https://cdn.example.com/ep1.mp4",
+	}, args)
+
+	args, err = playerCommand(Config{PlayerName: "custom", PlayerCommand: "celluloid"}, testStream, "Show")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"celluloid", "https://cdn.example.com/ep1.mp4"}, args, "the URL is appended without {url}")
+
+	_, err = playerCommand(Config{PlayerName: "custom"}, testStream, "Show")
+	assert.Error(t, err)
+}
+
+func TestPlayerCommandUnknown(t *testing.T) {
+	_, err := playerCommand(Config{PlayerName: "quicktime"}, testStream, "Show")
+	assert.ErrorContains(t, err, "unknown Player.Name")
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package src
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+preallocate reserves size bytes on disk for file with fallocate, so a segmented
+download cannot run out of space halfway. Filesystems without fallocate get a sparse
+file of that size instead.
+*/
+func preallocate(file *os.File, size int64) error {
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return file.Truncate(size)
+	}
+	return err
+}
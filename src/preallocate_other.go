@@ -0,0 +1,10 @@
+//go:build !linux
+
+package src
+
+import "os"
+
+// preallocate sizes file to size bytes; without fallocate the file is sparse, so no disk space is reserved
+func preallocate(file *os.File, size int64) error {
+	return file.Truncate(size)
+}
@@ -0,0 +1,250 @@
+package src
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+resultFilter is a parsed filter expression applied to the search results held in
+Tab1Model.data. An expression is a space separated list of terms, all of which must
+match, e.g. `status:ongoing type:TV score>7.5 dub>0 genre:romance`.
+Bare words without a field are matched against the romaji and english titles.
+*/
+type resultFilter struct {
+	terms []filterTerm
+}
+
+type filterTerm struct {
+	field string
+	op    string
+	value string
+	num   float64
+}
+
+// resultSort selects the client side ordering of search results
+type resultSort int
+
+const (
+	sortNone resultSort = iota
+	sortScore
+	sortEpisodes
+	sortTitle
+)
+
+// column indices of the rows produced by extractInfo
+const (
+	colID = iota
+	colTitle
+	colSubCount
+	colDubCount
+	colSubEpisodes
+	colDubEpisodes
+	colEnglishName
+	colDescription
+	colGenres
+	colStatus
+	colType
+	colRating
+	colScore
+	colThumbnail
+)
+
+var textFilterFields = map[string]int{
+	"title":   colTitle,
+	"english": colEnglishName,
+	"status":  colStatus,
+	"type":    colType,
+	"rating":  colRating,
+	"genre":   colGenres,
+}
+
+var numericFilterFields = map[string]int{
+	"score": colScore,
+	"sub":   colSubCount,
+	"dub":   colDubCount,
+	"eps":   colSubCount,
+}
+
+// filterOperators is ordered so that two character operators are tried first
+var filterOperators = []string{">=", "<=", "!=", ":", "=", ">", "<"}
+
+/*
+parseResultFilter parses a filter expression into a resultFilter.
+An error is returned for missing values, unsupported operators or non-numeric values
+given to numeric fields, so the filter bar can report it back to the user.
+*/
+func parseResultFilter(expr string) (resultFilter, error) {
+	var f resultFilter
+	for _, word := range strings.Fields(expr) {
+		term, err := parseFilterTerm(word)
+		if err != nil {
+			return resultFilter{}, err
+		}
+		f.terms = append(f.terms, term)
+	}
+	return f, nil
+}
+
+func parseFilterTerm(word string) (filterTerm, error) {
+	for _, op := range filterOperators {
+		idx := strings.Index(word, op)
+		if idx <= 0 {
+			continue
+		}
+		field := strings.ToLower(word[:idx])
+		value := word[idx+len(op):]
+		if value == "" {
+			return filterTerm{}, fmt.Errorf("missing value for %q", field)
+		}
+
+		if _, ok := numericFilterFields[field]; ok {
+			num, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return filterTerm{}, fmt.Errorf("%q expects a number, got %q", field, value)
+			}
+			return filterTerm{field: field, op: op, num: num}, nil
+		}
+		if _, ok := textFilterFields[field]; ok {
+			if op != ":" && op != "=" && op != "!=" {
+				return filterTerm{}, fmt.Errorf("operator %q is not supported for %q", op, field)
+			}
+			return filterTerm{field: field, op: op, value: strings.ToLower(value)}, nil
+		}
+		// unknown fields are treated as part of a title, so "re:zero" still works
+		break
+	}
+	return filterTerm{field: "", op: ":", value: strings.ToLower(word)}, nil
+}
+
+// empty reports whether the filter has no terms and therefore matches everything
+func (f resultFilter) empty() bool {
+	return len(f.terms) == 0
+}
+
+// matches reports whether a search result row satisfies every term of the filter
+func (f resultFilter) matches(row []any) bool {
+	for _, term := range f.terms {
+		if !term.matches(row) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t filterTerm) matches(row []any) bool {
+	if col, ok := numericFilterFields[t.field]; ok {
+		v := rowFloat(row, col)
+		switch t.op {
+		case ">":
+			return v > t.num
+		case ">=":
+			return v >= t.num
+		case "<":
+			return v < t.num
+		case "<=":
+			return v <= t.num
+		case "!=":
+			return v != t.num
+		default:
+			return v == t.num
+		}
+	}
+
+	var haystack []string
+	if t.field == "" {
+		haystack = []string{rowString(row, colTitle), rowString(row, colEnglishName)}
+	} else if col := textFilterFields[t.field]; col == colGenres {
+		haystack, _ = row[col].([]string)
+	} else {
+		haystack = []string{rowString(row, col)}
+	}
+
+	found := false
+	for _, s := range haystack {
+		s = strings.ToLower(s)
+		if (t.op == ":" && strings.Contains(s, t.value)) || (t.op != ":" && s == t.value) {
+			found = true
+			break
+		}
+	}
+	if t.op == "!=" {
+		return !found
+	}
+	return found
+}
+
+/*
+visibleResults returns the indices into data of the rows that pass the filter,
+ordered by the requested sort. Indices are returned instead of rows so the table
+can keep pointing back at the original result (its first column is index+1).
+*/
+func visibleResults(data [][]any, f resultFilter, order resultSort) []int {
+	indices := []int{}
+	for i, row := range data {
+		if f.matches(row) {
+			indices = append(indices, i)
+		}
+	}
+
+	less := func(a, b []any) bool { return false }
+	switch order {
+	case sortScore:
+		less = func(a, b []any) bool { return rowFloat(a, colScore) > rowFloat(b, colScore) }
+	case sortEpisodes:
+		less = func(a, b []any) bool {
+			return rowFloat(a, colSubCount) > rowFloat(b, colSubCount)
+		}
+	case sortTitle:
+		less = func(a, b []any) bool {
+			return strings.ToLower(rowString(a, colTitle)) < strings.ToLower(rowString(b, colTitle))
+		}
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return less(data[indices[i]], data[indices[j]])
+	})
+	return indices
+}
+
+// String returns a short label for the sort order used in the results status line
+func (s resultSort) String() string {
+	switch s {
+	case sortScore:
+		return "score ↓"
+	case sortEpisodes:
+		return "episodes ↓"
+	case sortTitle:
+		return "title A-Z"
+	default:
+		return "relevance"
+	}
+}
+
+// rowString safely reads a string column from a search result row
+func rowString(row []any, col int) string {
+	if col >= len(row) {
+		return ""
+	}
+	s, _ := row[col].(string)
+	return s
+}
+
+// rowFloat safely reads a numeric column that the API may return as a number or a string
+func rowFloat(row []any, col int) float64 {
+	if col >= len(row) {
+		return 0
+	}
+	switch v := row[col].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	default:
+		return 0
+	}
+}
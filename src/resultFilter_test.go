@@ -0,0 +1,66 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testResultRows() [][]any {
+	row := func(id, title string, sub, dub any, english string, genres []string, status, animeType, rating string, score any) []any {
+		return []any{id, title, sub, dub, []string{}, []string{}, english, "", genres, status, animeType, rating, score, ""}
+	}
+	return [][]any{
+		row("a", "Kimi ni Todoke", 25, 0, "From Me to You", []string{"Romance", "Drama"}, "Finished", "TV", "PG-13", 7.9),
+		row("b", "Sousou no Frieren", 28, 28, "Frieren", []string{"Adventure", "Fantasy"}, "Ongoing", "TV", "PG-13", 9.3),
+		row("c", "Kimi no Na wa.", 1, 1, "Your Name.", []string{"Romance", "Drama"}, "Finished", "Movie", "PG-13", 8.8),
+		row("d", "Horimiya", 13, "13", "Horimiya", []string{"Romance", "Comedy"}, "Finished", "TV", "PG-13", "8.2"),
+	}
+}
+
+func TestResultFilterMatches(t *testing.T) {
+	data := testResultRows()
+
+	testCases := []struct {
+		name     string
+		expr     string
+		expected []int
+	}{
+		{name: "Empty filter", expr: "", expected: []int{0, 1, 2, 3}},
+		{name: "Status", expr: "status:ongoing", expected: []int{1}},
+		{name: "Type exact", expr: "type=tv", expected: []int{0, 1, 3}},
+		{name: "Score threshold", expr: "score>8.5", expected: []int{1, 2}},
+		{name: "Dub count from string", expr: "dub>0 type:TV", expected: []int{1, 3}},
+		{name: "Genre", expr: "genre:romance", expected: []int{0, 2, 3}},
+		{name: "Negated genre", expr: "genre!=comedy genre:romance", expected: []int{0, 2}},
+		{name: "Bare words match both titles", expr: "your", expected: []int{2}},
+		{name: "Unknown field is a title word", expr: "kimi:no", expected: []int{}},
+		{name: "Combined", expr: "status:ongoing type:TV score>7.5 dub>0 genre:fantasy", expected: []int{1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := parseResultFilter(tc.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, visibleResults(data, f, sortNone))
+		})
+	}
+}
+
+func TestResultFilterErrors(t *testing.T) {
+	for _, expr := range []string{"score>high", "status:", "genre>romance"} {
+		_, err := parseResultFilter(expr)
+		assert.Error(t, err, "expected %q to be rejected", expr)
+	}
+}
+
+func TestResultSorting(t *testing.T) {
+	data := testResultRows()
+
+	assert.Equal(t, []int{1, 2, 3, 0}, visibleResults(data, resultFilter{}, sortScore))
+	assert.Equal(t, []int{1, 0, 3, 2}, visibleResults(data, resultFilter{}, sortEpisodes))
+	assert.Equal(t, []int{3, 0, 2, 1}, visibleResults(data, resultFilter{}, sortTitle))
+
+	f, _ := parseResultFilter("genre:romance")
+	assert.Equal(t, []int{2, 3, 0}, visibleResults(data, f, sortScore))
+}
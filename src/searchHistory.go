@@ -0,0 +1,169 @@
+package src
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSearchHistorySize is used when SearchHistorySize is missing from config.yaml
+const defaultSearchHistorySize = 50
+
+/*
+SearchHistory keeps the most recent search queries and the anime titles that were
+seen in search results. Queries are recalled shell-style with up/down in the search
+input, and both queries and titles are offered as inline completion suggestions.
+The history is persisted as JSON under ~/.local/share/kaizen/.
+*/
+type SearchHistory struct {
+	Queries []string `json:"queries"`
+	Titles  []string `json:"titles"`
+
+	path   string
+	limit  int
+	cursor int
+	draft  string
+}
+
+// searchHistoryPath returns the location of the persisted search history file
+func searchHistoryPath() string {
+	return ExpandPath("~/.local/share/kaizen/history.json")
+}
+
+/*
+LoadSearchHistory reads the search history stored at path. A missing or unreadable
+file simply yields an empty history so that searching is never blocked by it.
+limit caps the number of queries kept; titles are capped at ten times that amount.
+*/
+func LoadSearchHistory(path string, limit int) *SearchHistory {
+	if limit <= 0 {
+		limit = defaultSearchHistorySize
+	}
+	h := &SearchHistory{path: path, limit: limit, cursor: -1}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		_ = json.Unmarshal(data, h)
+	}
+	h.Queries = trimHistory(h.Queries, h.limit)
+	h.Titles = trimHistory(h.Titles, h.limit*10)
+	return h
+}
+
+// Save writes the history back to disk, creating the parent directory if needed
+func (h *SearchHistory) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
+
+// Add records a query as the most recent entry, moving it to the end if it already exists
+func (h *SearchHistory) Add(query string) {
+	query = strings.TrimSpace(query)
+	h.ResetCursor()
+	if query == "" {
+		return
+	}
+	h.Queries = trimHistory(appendUnique(h.Queries, query), h.limit)
+}
+
+// AddTitles remembers anime titles seen in search results for use as suggestions
+func (h *SearchHistory) AddTitles(titles ...string) {
+	for _, title := range titles {
+		title = strings.TrimSpace(title)
+		if title == "" {
+			continue
+		}
+		h.Titles = appendUnique(h.Titles, title)
+	}
+	h.Titles = trimHistory(h.Titles, h.limit*10)
+}
+
+/*
+Prev moves one step back in the query history. current is the text in the input
+box and is restored once the user walks forward past the newest entry.
+The boolean result is false when there is nothing older to recall.
+*/
+func (h *SearchHistory) Prev(current string) (string, bool) {
+	if len(h.Queries) == 0 {
+		return "", false
+	}
+	if h.cursor == -1 {
+		h.draft = current
+		h.cursor = len(h.Queries)
+	}
+	if h.cursor == 0 {
+		return "", false
+	}
+	h.cursor--
+	return h.Queries[h.cursor], true
+}
+
+// Next moves one step forward in the query history, ending on the original draft
+func (h *SearchHistory) Next() (string, bool) {
+	if h.cursor == -1 {
+		return "", false
+	}
+	h.cursor++
+	if h.cursor >= len(h.Queries) {
+		draft := h.draft
+		h.ResetCursor()
+		return draft, true
+	}
+	return h.Queries[h.cursor], true
+}
+
+// ResetCursor stops history browsing, e.g. when the user edits the input
+func (h *SearchHistory) ResetCursor() {
+	h.cursor = -1
+	h.draft = ""
+}
+
+// Suggestions returns recent queries (newest first) followed by seen titles
+func (h *SearchHistory) Suggestions() []string {
+	seen := make(map[string]bool)
+	suggestions := []string{}
+	add := func(s string) {
+		k := strings.ToLower(s)
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		suggestions = append(suggestions, s)
+	}
+	for i := len(h.Queries) - 1; i >= 0; i-- {
+		add(h.Queries[i])
+	}
+	for i := len(h.Titles) - 1; i >= 0; i-- {
+		add(h.Titles[i])
+	}
+	return suggestions
+}
+
+// appendUnique appends s to list, removing any earlier case-insensitive duplicate
+func appendUnique(list []string, s string) []string {
+	out := list[:0:0]
+	for _, existing := range list {
+		if !strings.EqualFold(existing, s) {
+			out = append(out, existing)
+		}
+	}
+	return append(out, s)
+}
+
+// trimHistory keeps only the newest limit entries
+func trimHistory(list []string, limit int) []string {
+	if len(list) > limit {
+		return list[len(list)-limit:]
+	}
+	return list
+}
@@ -0,0 +1,58 @@
+package src
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchHistoryRecall(t *testing.T) {
+	h := LoadSearchHistory(filepath.Join(t.TempDir(), "history.json"), 3)
+
+	h.Add("naruto")
+	h.Add("one piece")
+	h.Add("bleach")
+	h.Add("Naruto")
+	h.Add("frieren")
+
+	assert.Equal(t, []string{"bleach", "Naruto", "frieren"}, h.Queries, "history should dedupe and keep the newest entries")
+
+	query, ok := h.Prev("fri")
+	assert.True(t, ok)
+	assert.Equal(t, "frieren", query)
+
+	query, _ = h.Prev(query)
+	assert.Equal(t, "Naruto", query)
+	query, _ = h.Prev(query)
+	assert.Equal(t, "bleach", query)
+
+	_, ok = h.Prev(query)
+	assert.False(t, ok, "should stop at the oldest entry")
+
+	query, _ = h.Next()
+	assert.Equal(t, "Naruto", query)
+	query, _ = h.Next()
+	assert.Equal(t, "frieren", query)
+
+	query, ok = h.Next()
+	assert.True(t, ok)
+	assert.Equal(t, "fri", query, "walking past the newest entry should restore the draft")
+
+	_, ok = h.Next()
+	assert.False(t, ok)
+}
+
+func TestSearchHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kaizen", "history.json")
+
+	h := LoadSearchHistory(path, 10)
+	h.Add("one piece")
+	h.AddTitles("One Piece", "One Piece Film: Red", "")
+	assert.NoError(t, h.Save())
+
+	loaded := LoadSearchHistory(path, 10)
+	assert.Equal(t, []string{"one piece"}, loaded.Queries)
+	assert.Equal(t, []string{"one piece", "One Piece Film: Red"}, loaded.Suggestions(),
+		"suggestions should list queries first and skip case-insensitive duplicates")
+}
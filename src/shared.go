@@ -37,12 +37,20 @@ func ExecuteAppStub() {
 
 	m.currentTab = 0
 	m.tab1 = NewTab1Model()
+	m.library = NewLibraryModel(m.tab1.watched)
 	m.tab2 = NewTab2Model()
+	m.downloadM.history = LoadDownloadHistory(downloadHistoryPath())
+	m.downloads = newDownloadEngine(appCtx, configuredDownloadWindow(), configuredDownloadBackend())
+	m.restorePrompt = len(m.downloadM.history.Pending()) > 0
+	m.refreshHistoryList()
 	m.styles = NewTabStyles()
 	m.currentScreen = AppScreen
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	_, err := p.Run()
+	// abort every request and download that is still in flight
+	cancelAppCtx()
+	if err != nil {
 		fmt.Printf("Error starting app: %v\n", err)
 	}
 }
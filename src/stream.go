@@ -0,0 +1,75 @@
+package src
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+/*
+StreamDescriptor is a resolved episode stream: the direct URL together with every
+header the host expects (Referer, User-Agent and the extra headers from config.yaml).
+Playback and downloads are both built from it so they always send the same request.
+*/
+type StreamDescriptor struct {
+	URL     string
+	Headers http.Header
+}
+
+/*
+resolveStream looks up the streaming link for an episode and attaches the session
+referer and configured headers to it. A referer that cannot be fetched is not fatal;
+the stream is returned without one, as some hosts do not need it.
+*/
+func resolveStream(ctx context.Context, id, episodeType, episodeNumber string) (StreamDescriptor, error) {
+	link, err := getStreamLink(ctx, id, episodeType, episodeNumber)
+	if err != nil {
+		return StreamDescriptor{}, err
+	}
+
+	headers := networkHeaders(conf)
+	if referer, err := sessionReferer(ctx); err == nil && referer != "" {
+		headers.Set("Referer", referer)
+	}
+	return StreamDescriptor{URL: link, Headers: headers}, nil
+}
+
+// NewRequest builds a GET request for the stream carrying its headers
+func (s StreamDescriptor) NewRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range s.Headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	return req, nil
+}
+
+// refererCache holds the referer once it has been fetched successfully
+var refererCache struct {
+	sync.Mutex
+	value  string
+	loaded bool
+}
+
+/*
+sessionReferer returns the streaming referer, fetching it with getReferer the first
+time it is needed and reusing it for the rest of the session. Failed lookups are not
+cached, so the next stream tries again.
+*/
+func sessionReferer(ctx context.Context) (string, error) {
+	refererCache.Lock()
+	defer refererCache.Unlock()
+	if refererCache.loaded {
+		return refererCache.value, nil
+	}
+
+	referer, err := getReferer(ctx)
+	if err != nil {
+		return "", err
+	}
+	refererCache.value = referer
+	refererCache.loaded = true
+	return referer, nil
+}
@@ -0,0 +1,309 @@
+package src
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// request headers a player sends that are passed on upstream, so seeking and caching work
+var proxiedRequestHeaders = []string{"Range", "If-Range", "If-Modified-Since", "If-None-Match"}
+
+// upstream response headers passed back to the player
+var proxiedResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "Etag"}
+
+// proxiedStream is a stream served by the proxy; resolve fetches a fresh link once the old one expired
+type proxiedStream struct {
+	mu      sync.Mutex
+	stream  StreamDescriptor
+	resolve func(context.Context) (StreamDescriptor, error)
+}
+
+func (s *proxiedStream) current() StreamDescriptor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream
+}
+
+func (s *proxiedStream) replace(stream StreamDescriptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = stream
+}
+
+/*
+streamProxy serves episode streams on a plain local URL, sending the Referer,
+User-Agent and configured headers the host expects itself. Players, browsers and TVs
+that cannot set headers can then play them. Range requests are passed through, so
+seeking works, and an expired link is refreshed on the fly.
+*/
+type streamProxy struct {
+	listener net.Listener
+	server   *http.Server
+	client   *http.Client
+
+	mu      sync.Mutex
+	streams map[string]*proxiedStream
+}
+
+// newStreamProxy starts a proxy listening on addr that fetches streams with client
+func newStreamProxy(addr string, client *http.Client) (*streamProxy, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not start the stream proxy on %s: %v", addr, err)
+	}
+	p := &streamProxy{listener: listener, client: client, streams: make(map[string]*proxiedStream)}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	go p.server.Serve(listener) //nolint:errcheck
+	return p, nil
+}
+
+/*
+Add serves stream under a new path that cannot be guessed and returns its URL. name
+becomes the last path segment, which players show as the title.
+*/
+func (p *streamProxy) Add(name string, stream StreamDescriptor, resolve func(context.Context) (StreamDescriptor, error)) string {
+	token := make([]byte, 12)
+	rand.Read(token) //nolint:errcheck
+	key := hex.EncodeToString(token)
+
+	p.mu.Lock()
+	p.streams[key] = &proxiedStream{stream: stream, resolve: resolve}
+	p.mu.Unlock()
+	return fmt.Sprintf("http://%s/stream/%s/%s", listenerHost(p.listener.Addr()), key, url.PathEscape(name))
+}
+
+// Close stops the proxy and drops the connections of players still streaming
+func (p *streamProxy) Close() error {
+	return p.server.Close()
+}
+
+func (p *streamProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/stream/")
+	key, _, _ := strings.Cut(rest, "/")
+	p.mu.Lock()
+	s, known := p.streams[key]
+	p.mu.Unlock()
+	if !ok || !known {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := p.fetch(r, s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, name := range proxiedResponseHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			w.Header()[name] = values
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, resp.Body) //nolint:errcheck
+	}
+}
+
+// fetch forwards r upstream; when the link has expired it resolves a fresh one and tries once more
+func (p *streamProxy) fetch(r *http.Request, s *proxiedStream) (*http.Response, error) {
+	resp, err := p.forward(r, s.current())
+	if err != nil || s.resolve == nil ||
+		(resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusGone) {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	stream, err := s.resolve(r.Context())
+	if err != nil {
+		return nil, fmt.Errorf("the stream link expired and could not be refreshed: %v", err)
+	}
+	s.replace(stream)
+	return p.forward(r, stream)
+}
+
+// forward requests stream with the stream's headers and the player's range and cache headers
+func (p *streamProxy) forward(r *http.Request, stream StreamDescriptor) (*http.Response, error) {
+	req, err := stream.NewRequest(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Method = r.Method
+	for _, name := range proxiedRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	return p.client.Do(req)
+}
+
+/*
+listenerHost returns the host:port other programs reach a listener at: its own
+address, or this machine's LAN address when it listens on all interfaces.
+*/
+func listenerHost(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return addr.String()
+	}
+	ip := tcp.IP
+	if ip.IsUnspecified() {
+		ip = lanIP()
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(tcp.Port))
+}
+
+// lanIP returns the first private IPv4 address of this machine, or the loopback address without one
+func lanIP() net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.IP.IsPrivate() {
+				return ipNet.IP
+			}
+		}
+	}
+	return net.IPv4(127, 0, 0, 1)
+}
+
+// sessionProxy is the stream proxy of the TUI, started the first time an episode is served
+var sessionProxy struct {
+	sync.Mutex
+	proxy *streamProxy
+}
+
+// sessionStreamProxy returns the TUI's stream proxy, starting it on StreamProxy.Listen if needed
+func sessionStreamProxy() (*streamProxy, error) {
+	sessionProxy.Lock()
+	defer sessionProxy.Unlock()
+	if sessionProxy.proxy == nil {
+		proxy, err := newStreamProxy(conf.StreamProxyListen, apiClient.client)
+		if err != nil {
+			return nil, err
+		}
+		sessionProxy.proxy = proxy
+	}
+	return sessionProxy.proxy, nil
+}
+
+// streamProxyMsg carries the proxy URL an episode is served at, or why it could not be served
+type streamProxyMsg struct {
+	title string
+	url   string
+	err   error
+}
+
+// serveSelectedEpisode serves the episode selected in the focused list through the session's stream proxy
+func (m *Tab1Model) serveSelectedEpisode() tea.Cmd {
+	episodeList := m.listOne
+	if m.focus == listTwoFocus {
+		episodeList = m.listTwo
+	}
+	ref, ok := selectedEpisode(episodeList)
+	if !ok {
+		return nil
+	}
+	animeID := m.animeID
+	title := fmt.Sprintf("%s %s (%s)", m.animeName, ref.Label(), strings.ToUpper(ref.Type))
+
+	return func() tea.Msg {
+		resolve := func(ctx context.Context) (StreamDescriptor, error) {
+			return resolveStream(ctx, animeID, ref.Type, ref.ID)
+		}
+		stream, err := resolve(appCtx)
+		if err != nil {
+			return streamProxyMsg{title: title, err: err}
+		}
+		proxy, err := sessionStreamProxy()
+		if err != nil {
+			return streamProxyMsg{title: title, err: err}
+		}
+		return streamProxyMsg{title: title, url: proxy.Add(title+".mp4", stream, resolve)}
+	}
+}
+
+// showStreamProxy shows the proxy URL of an episode below the lists and copies it to the clipboard
+func (m *Tab1Model) showStreamProxy(msg streamProxyMsg) {
+	if msg.err != nil {
+		m.banner = newErrorBanner(msg.title, msg.err, false)
+		return
+	}
+	m.banner = ErrorBanner{}
+	m.proxyLink = msg.url
+	m.proxyCopied = clipboard.WriteAll(msg.url) == nil
+}
+
+/*
+ServeStream runs the serve-stream command: it resolves one episode and serves it
+through the stream proxy until interrupted, printing the URL to open in any player.
+*/
+func ServeStream(args []string) error {
+	flags := flag.NewFlagSet("serve-stream", flag.ContinueOnError)
+	dub := flags.Bool("dub", false, "serve the dubbed episode")
+	listen := flags.String("listen", conf.StreamProxyListen, "address to listen on, e.g. 0.0.0.0:8787 to reach it from other devices")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: kaizen serve-stream [-dub] [-listen address] <anime id> <episode>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("serve-stream needs an anime id and an episode")
+	}
+	episodeType := "sub"
+	if *dub {
+		episodeType = "dub"
+	}
+	animeID := flags.Arg(0)
+	ref, err := ParseEpisodeRef(flags.Arg(1), episodeType)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(appCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	resolve := func(ctx context.Context) (StreamDescriptor, error) {
+		return resolveStream(ctx, animeID, ref.Type, ref.ID)
+	}
+	stream, err := resolve(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch the stream link: %v", err)
+	}
+	proxy, err := newStreamProxy(*listen, apiClient.client)
+	if err != nil {
+		return err
+	}
+	defer proxy.Close()
+
+	link := proxy.Add(fmt.Sprintf("%s %s (%s).mp4", animeID, ref.Label(), strings.ToUpper(ref.Type)), stream, resolve)
+	fmt.Printf("\033[0;32m [+] Serving %s (%s) at\033[0m\n     %s\n     press Ctrl+C to stop\n", ref.Label(), strings.ToUpper(ref.Type), link)
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,118 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// refererServer serves body with range support to requests carrying the expected Referer only
+func refererServer(t *testing.T, body []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://example.com/" || r.URL.Path == "/expired" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "ep.mp4", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testStreamProxy(t *testing.T) *streamProxy {
+	p, err := newStreamProxy("127.0.0.1:0", http.DefaultClient)
+	assert.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestStreamProxyInjectsHeadersAndRanges(t *testing.T) {
+	body := []byte("0123456789")
+	upstream := refererServer(t, body)
+	p := testStreamProxy(t)
+	link := p.Add("Show Episode 1 (SUB).mp4", StreamDescriptor{
+		URL:     upstream.URL + "/ep.mp4",
+		Headers: http.Header{"Referer": {"https://example.com/"}},
+	}, nil)
+	assert.True(t, strings.HasPrefix(link, "http://127.0.0.1:"))
+	assert.True(t, strings.HasSuffix(link, "/Show%20Episode%201%20%28SUB%29.mp4"))
+
+	resp, err := http.Get(link)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, body, data)
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+
+	req, _ := http.NewRequest(http.MethodGet, link, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	data, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "2345", string(data))
+	assert.Equal(t, "bytes 2-5/10", resp.Header.Get("Content-Range"))
+}
+
+func TestStreamProxyRefreshesExpiredLink(t *testing.T) {
+	upstream := refererServer(t, []byte("episode"))
+	p := testStreamProxy(t)
+	headers := http.Header{"Referer": {"https://example.com/"}}
+	var resolved atomic.Int32
+	link := p.Add("ep.mp4", StreamDescriptor{URL: upstream.URL + "/expired", Headers: headers},
+		func(ctx context.Context) (StreamDescriptor, error) {
+			resolved.Add(1)
+			return StreamDescriptor{URL: upstream.URL + "/fresh", Headers: headers}, nil
+		})
+
+	for range 2 {
+		resp, err := http.Get(link)
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "episode", string(data))
+	}
+	assert.EqualValues(t, 1, resolved.Load(), "the fresh link is kept for later requests")
+}
+
+func TestStreamProxyRejectsUnknownStreams(t *testing.T) {
+	p := testStreamProxy(t)
+	link := p.Add("ep.mp4", StreamDescriptor{URL: "http://127.0.0.1:1/ep.mp4"}, nil)
+	base := link[:strings.Index(link, "/stream/")]
+
+	resp, err := http.Get(base + "/stream/0123456789abcdef/ep.mp4")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(link, "text/plain", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(link)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode, "an unreachable upstream is reported as such")
+}
+
+func TestListenerHost(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:8787", listenerHost(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8787}))
+
+	host := listenerHost(&net.TCPAddr{IP: net.IPv4zero, Port: 8787})
+	ip, port, err := net.SplitHostPort(host)
+	assert.NoError(t, err)
+	assert.Equal(t, "8787", port)
+	assert.False(t, net.ParseIP(ip).IsUnspecified(), "a wildcard listener is reached through a real address")
+}
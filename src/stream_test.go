@@ -0,0 +1,69 @@
+package src
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRefererIsCached(t *testing.T) {
+	defaultClient, defaultURL := apiClient, refererURL
+	apiClient = newTestHTTPClient(0)
+	defer func() {
+		apiClient, refererURL = defaultClient, defaultURL
+		refererCache.value, refererCache.loaded = "", false
+	}()
+
+	var calls int32
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"referer":"https://example.com/"}`)) //nolint:errcheck
+	}))
+	defer server.Close()
+	refererURL = server.URL
+	refererCache.value, refererCache.loaded = "", false
+
+	_, err := sessionReferer(context.Background())
+	assert.Error(t, err)
+
+	failing = false
+	for i := 0; i < 3; i++ {
+		referer, err := sessionReferer(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/", referer)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "a failed lookup is retried, a successful one is reused")
+}
+
+func TestStreamDescriptorHeaders(t *testing.T) {
+	stream := StreamDescriptor{
+		URL: "https://cdn.example.com/ep1.mp4",
+		Headers: http.Header{
+			"Referer":    {"https://example.com/"},
+			"User-Agent": {"Mozilla/5.0"},
+			"Cookie":     {"a=b"},
+		},
+	}
+
+	req, err := stream.NewRequest(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/", req.Header.Get("Referer"))
+	assert.Equal(t, "Mozilla/5.0", req.Header.Get("User-Agent"))
+
+	assert.Equal(t, []string{
+		"--http-header-fields-append=Cookie: a=b",
+		"--http-header-fields-append=Referer: https://example.com/",
+		"--user-agent=Mozilla/5.0",
+	}, mpvNetworkArgs(Config{NetworkProxy: "socks5://127.0.0.1:1080"}, stream))
+
+	assert.Equal(t, []string{"--http-proxy=http://proxy:8080"}, mpvNetworkArgs(Config{NetworkProxy: "http://proxy:8080"}, StreamDescriptor{}))
+}
@@ -2,9 +2,10 @@ package src
 
 import (
 	"fmt"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/table"
@@ -14,12 +15,15 @@ import (
 /*
 generateRows is a method of Tab1Model that converts a two-dimensional slice of interface{} data into a slice of table.Row.
 Each row in the table is constructed by extracting and formatting specific fields from the input data.
+Only rows passing the active filter are included, in the active sort order; the first column always
+holds the row's original position in data (1-based) so selections map back to the right result.
 The rows are intended to be displayed in a tabular Bubble Tea model.
 */
 func (m *Tab1Model) generateRows(data [][]any) []table.Row {
 	m.loading = false
 	rows := []table.Row{}
-	for i, item := range data {
+	for _, i := range visibleResults(data, m.filter, m.sortMode) {
+		item := data[i]
 		centerText := func(text string, width int) string {
 			if len(text) >= width {
 				return text
@@ -101,91 +105,290 @@ func (m *Tab1Model) generateRows(data [][]any) []table.Row {
 	return rows
 }
 
+/*
+selectedEpisode returns the EpisodeRef of the item under the cursor of an episode list.
+The boolean result is false when nothing is selected or the list only holds its placeholder.
+*/
+func selectedEpisode(episodeList list.Model) (EpisodeRef, bool) {
+	i, ok := episodeList.SelectedItem().(item)
+	if !ok || i.style == "none" || i.ref.ID == "" {
+		return EpisodeRef{}, false
+	}
+	return i.ref, true
+}
+
 /*
 streamSubAnime is a method of Tab1Model that streams a selected subbed anime episode.
-It extracts the selected episode number, determines the streaming link using getStreamLink,
-and invokes the MPV media player to play the episode in full-screen mode.
+It takes the selected episode from the Sub list and hands it to streamEpisode.
 */
 func (m *Tab1Model) streamSubAnime() {
-	SubEpisodeString := fmt.Sprintf("%s", m.listOne.SelectedItem()) //nolint:govet // Ignore the warning for this line
-	SubEpisodeString = SubEpisodeString[8:12]
-	SubEpisodeString = strings.ReplaceAll(SubEpisodeString, " ", "")
-	m.subSelectedNum = SubEpisodeString
-	m.episodeType = "sub"
-	link, _ := getStreamLink(m.animeID, m.episodeType, m.subSelectedNum)
-	m.streamLink = link
-	if m.streamLink != "" {
-		referer, _ := getReferer()
-		streamTitle := fmt.Sprintf("--force-media-title=%s Episode %s (SUB)", m.animeName, m.subSelectedNum)
-		headerFields := fmt.Sprintf("Referer: %s,User-Agent: Mozilla/5.0", referer)
-		stream := exec.Command("mpv", "--http-header-fields="+headerFields, "-fs", "--profile=fast", m.streamLink, streamTitle)
-		stream.Output() //nolint:errcheck
-	} else {
-		fmt.Println("no link found")
+	if ref, ok := selectedEpisode(m.listOne); ok {
+		m.subSelectedNum = ref.ID
+		m.streamEpisode(&m.listOne, ref)
 	}
 }
 
 /*
 streamDubAnime is a method of Tab1Model that streams a selected dubbed anime episode.
-It operates similarly to streamSubAnime, but it sets the episode type to "dub"
-and fetches the streaming link accordingly before playing the episode with MPV.
+It operates similarly to streamSubAnime, but takes the episode from the Dub list.
 */
 func (m *Tab1Model) streamDubAnime() {
-	DubEpisodeString := fmt.Sprintf("%s", m.listTwo.SelectedItem()) //nolint:govet // Ignore the warning for this line
-	DubEpisodeString = DubEpisodeString[8:12]
-	DubEpisodeString = strings.ReplaceAll(DubEpisodeString, " ", "")
-	m.dubSelectedNum = DubEpisodeString
-	m.episodeType = "dub"
-	link, _ := getStreamLink(m.animeID, m.episodeType, m.dubSelectedNum)
-	m.streamLink = link
+	if ref, ok := selectedEpisode(m.listTwo); ok {
+		m.dubSelectedNum = ref.ID
+		m.streamEpisode(&m.listTwo, ref)
+	}
+}
+
+/*
+streamEpisode is a method of Tab1Model that resolves the stream for an episode
+using resolveStream, plays it in the configured player and marks it as watched in the
+list it was picked from. In offline mode, or when the API
+cannot be reached, a downloaded copy of the episode is played instead. If neither is
+available the error banner explains why.
+*/
+func (m *Tab1Model) streamEpisode(episodeList *list.Model, ref EpisodeRef) {
+	m.episodeType = ref.Type
+	stream, err := resolveStream(appCtx, m.animeID, ref.Type, ref.ID)
+	m.streamLink = stream.URL
+	if err != nil {
+		if path, ok := localEpisodePath(m.animeName, m.animeID, ref); ok && asAPIError("stream link", err).Unavailable() {
+			m.banner = ErrorBanner{}
+			m.playLocalEpisode(episodeList, ref, path)
+			return
+		}
+		m.banner = newErrorBanner(fmt.Sprintf("%s %s", m.animeName, ref.Label()), err, false)
+		return
+	}
+	m.banner = ErrorBanner{}
 	if m.streamLink != "" {
-		referer, _ := getReferer()
-		streamTitle := fmt.Sprintf("--force-media-title=%s Episode %s (DUB)", m.animeName, m.dubSelectedNum)
-		headerFields := fmt.Sprintf("Referer: %s,User-Agent: Mozilla/5.0", referer)
-		stream := exec.Command("mpv", "--http-header-fields="+headerFields, "-fs", "--profile=fast", m.streamLink, streamTitle)
-		stream.Output() //nolint:errcheck
-	} else {
-		fmt.Println("no link found")
+		m.play(episodeList, ref, stream)
+	}
+}
+
+// playLocalEpisode plays a downloaded episode and marks it as watched
+func (m *Tab1Model) playLocalEpisode(episodeList *list.Model, ref EpisodeRef, path string) {
+	m.play(episodeList, ref, StreamDescriptor{URL: path})
+}
+
+// play plays the episode in the configured player, marking it as watched unless the player failed
+func (m *Tab1Model) play(episodeList *list.Model, ref EpisodeRef, stream StreamDescriptor) {
+	title := fmt.Sprintf("%s %s (%s)", m.animeName, ref.Label(), strings.ToUpper(ref.Type))
+	if err := playStream(stream, title); err != nil {
+		m.banner = newErrorBanner(title, err, false)
+		return
+	}
+	m.markEpisodeWatched(episodeList, ref)
+}
+
+/*
+mpvNetworkArgs returns the mpv flags that make playback send the same request as a
+download of the stream: its headers, the User-Agent and, for http(s) proxies,
+--http-proxy. mpv cannot use a socks5 proxy, so one is left out.
+*/
+func mpvNetworkArgs(c Config, stream StreamDescriptor) []string {
+	var args []string
+	headers := stream.Headers
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if name != "User-Agent" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--http-header-fields-append=%s: %s", name, headers.Get(name)))
 	}
+	if ua := headers.Get("User-Agent"); ua != "" {
+		args = append(args, "--user-agent="+ua)
+	}
+	if proxyURL, err := parseProxyURL(c.NetworkProxy); err == nil && proxyURL != nil &&
+		(proxyURL.Scheme == "http" || proxyURL.Scheme == "https") {
+		args = append(args, "--http-proxy="+proxyURL.String())
+	}
+	return args
 }
 
 /*
 generateSubEpisodes is a method of Tab1Model that generates a list of items representing subbed episodes.
-It creates a list of episodes from 1 to the given number, formatted with default styles.
+It creates an item for every available episode inside the active range filter, marking watched episodes.
 */
 func (m *Tab1Model) generateSubEpisodes() []list.Item {
-	availableSubEpisodes := m.availableSubEpisodes
-	items := []list.Item{}
-	for _, episode := range availableSubEpisodes {
-		items = append(items, item{title: "Episode " + episode + "               ", style: "default"})
-	}
-	return items
+	return m.episodeItems(m.availableSubEpisodes, "sub", m.subRange)
 }
 
 /*
 generateDubEpisodes is a method of Tab1Model that generates a list of items representing dubbed episodes.
-Like generateSubEpisodes, it creates a list of episodes from 1 to the given number, formatted with default styles.
+Like generateSubEpisodes, it applies the dub list's range filter and watched markers.
 */
 func (m *Tab1Model) generateDubEpisodes() []list.Item {
-	availableDubEpisodes := m.availableDubEpisodes
-	items := []list.Item{}
-	for _, episode := range availableDubEpisodes {
-		items = append(items, item{title: "Episode " + episode + "               ", style: "default"})
-	}
-	return items
+	return m.episodeItems(m.availableDubEpisodes, "dub", m.dubRange)
 }
 
 /*
-fetchAnimeData is a method of Tab1Model that retrieves anime data based on a given query.
+fetchAnimeData is a method of Tab1Model that retrieves one page of anime data based on a given query.
 It returns a Bubble Tea command (tea.Cmd) that fetches the data asynchronously.
-If an error occurs during data retrieval, it is returned as the command's message.
+If an error occurs during data retrieval, it is returned as a searchErrorMsg so the
+failed page can be reported and retried.
 */
-func (m *Tab1Model) fetchAnimeData(query string) tea.Cmd {
+func (m *Tab1Model) fetchAnimeData(query string, page int) tea.Cmd {
 	return func() tea.Msg {
-		data, err := extractInfo(query)
+		data, err := extractInfo(appCtx, query, page)
 		if err != nil {
-			return err
+			return searchErrorMsg{query: query, page: page, err: asAPIError("search", err)}
 		}
 		return data
 	}
 }
+
+/*
+showSearchError is a method of Tab1Model that stops the loading indicators and shows
+the error banner for a failed search page, remembering the page so it can be retried.
+*/
+func (m *Tab1Model) showSearchError(msg searchErrorMsg) {
+	m.loading = false
+	m.loadingMore = false
+	m.banner = newErrorBanner(msg.query, msg.err, true)
+	m.retryPage = 0
+	if m.banner.retryable {
+		m.retryPage = msg.page
+	}
+	if msg.page <= 1 {
+		m.data = [][]any{}
+		m.table.SetRows(m.generateRows(m.data))
+	}
+}
+
+/*
+retrySearch is a method of Tab1Model that re-requests the search page that last failed.
+*/
+func (m *Tab1Model) retrySearch() tea.Cmd {
+	page := m.retryPage
+	m.retryPage = 0
+	m.banner = ErrorBanner{}
+	if page <= 1 {
+		m.loading = true
+		return tea.Batch(m.fetchAnimeData(m.query, 1), m.spinner.Tick)
+	}
+	m.loadingMore = true
+	return m.fetchAnimeData(m.query, page)
+}
+
+/*
+applySearchPage is a method of Tab1Model that stores a page of search results.
+The first page replaces the current results while later pages are appended, skipping
+anime that are already listed in case the API repeats entries across pages.
+It returns the titles that were added so they can be remembered as suggestions.
+*/
+func (m *Tab1Model) applySearchPage(page searchPage) []string {
+	m.loadingMore = false
+	m.banner = ErrorBanner{}
+	m.retryPage = 0
+	m.hasNextPage = page.hasNext
+	m.totalResults = page.total
+
+	if page.page <= 1 {
+		m.data = [][]any{}
+		m.stale = false
+		m.fetchedAt = page.fetchedAt
+	}
+	m.stale = m.stale || page.stale
+	seen := make(map[string]bool, len(m.data))
+	for _, row := range m.data {
+		seen[rowString(row, colID)] = true
+	}
+
+	titles := []string{}
+	for _, row := range page.rows {
+		id := rowString(row, colID)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		m.data = append(m.data, row)
+		titles = append(titles, rowString(row, colTitle), rowString(row, colEnglishName))
+	}
+
+	// a page without anything new means the API does not page this query any further
+	if page.page > 1 && len(titles) == 0 {
+		m.hasNextPage = false
+	}
+
+	cursor := m.table.Cursor()
+	m.table.SetRows(m.generateRows(m.data))
+	if page.page > 1 {
+		m.table.SetCursor(cursor)
+	}
+	return titles
+}
+
+/*
+loadMoreResults is a method of Tab1Model that requests the next page of results once the
+table cursor reaches the last row. It returns nil when there is nothing more to fetch
+or a request is already in flight.
+*/
+func (m *Tab1Model) loadMoreResults() tea.Cmd {
+	rows := len(m.table.Rows())
+	if !m.hasNextPage || m.loadingMore || rows == 0 || m.table.Cursor() < rows-1 {
+		return nil
+	}
+	m.loadingMore = true
+	return m.fetchAnimeData(m.query, m.page+1)
+}
+
+/*
+resultCountText is a method of Tab1Model that describes how many results are shown,
+e.g. "10 of 42 results". The total comes from the API when it reports one; otherwise
+the number of fetched results is used, with a "+" when more pages are available.
+*/
+func (m *Tab1Model) resultCountText() string {
+	total := strconv.Itoa(len(m.data))
+	if m.totalResults > len(m.data) {
+		total = strconv.Itoa(m.totalResults)
+	} else if m.hasNextPage {
+		total += "+"
+	}
+	return fmt.Sprintf("%d of %s results", len(m.table.Rows()), total)
+}
+
+/*
+staleBadge is a method of Tab1Model that describes where the shown results came from
+when they are not live: "offline" while offline mode is on, otherwise how old the cached
+results are that were served because the API could not be reached.
+*/
+func (m *Tab1Model) staleBadge() string {
+	if !m.stale && !offlineMode {
+		return ""
+	}
+	badge := "offline"
+	if !m.stale {
+		return badge
+	}
+	badge += " • cached"
+	if !m.fetchedAt.IsZero() {
+		badge += " " + formatAge(time.Since(m.fetchedAt)) + " ago"
+	}
+	return badge
+}
+
+// formatAge renders a duration in the largest whole unit: 45s, 12m, 3h, 2d
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+/*
+refreshResults is a method of Tab1Model that re-applies the current filter and sort order
+to the already fetched search results without issuing a new network request.
+*/
+func (m *Tab1Model) refreshResults() {
+	m.table.SetRows(m.generateRows(m.data))
+	m.table.GotoTop()
+}
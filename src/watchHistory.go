@@ -0,0 +1,102 @@
+package src
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+WatchHistory records which episodes have been played, keyed by anime ID and
+episode type ("sub" or "dub"). It is used to draw watched/unwatched markers
+in the episode lists and is persisted as JSON under ~/.local/share/kaizen/.
+Titles maps anime IDs to names so downloaded files, which only carry the name,
+can be matched back to their watch history.
+*/
+type WatchHistory struct {
+	Anime  map[string]map[string]map[string]time.Time `json:"anime"`
+	Titles map[string]string                          `json:"titles,omitempty"`
+
+	path string
+}
+
+// watchHistoryPath returns the location of the persisted watch history file
+func watchHistoryPath() string {
+	return ExpandPath("~/.local/share/kaizen/watched.json")
+}
+
+/*
+LoadWatchHistory reads the watch history stored at path. A missing or corrupt
+file yields an empty history rather than an error so playback is never blocked.
+*/
+func LoadWatchHistory(path string) *WatchHistory {
+	h := &WatchHistory{path: path}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		_ = json.Unmarshal(data, h)
+	}
+	if h.Anime == nil {
+		h.Anime = make(map[string]map[string]map[string]time.Time)
+	}
+	if h.Titles == nil {
+		h.Titles = make(map[string]string)
+	}
+	return h
+}
+
+// SetTitle remembers the name of an anime ID
+func (h *WatchHistory) SetTitle(animeID, name string) {
+	if animeID == "" || name == "" {
+		return
+	}
+	h.Titles[animeID] = name
+}
+
+/*
+IDForTitle returns the anime ID recorded for name. name may also be the sanitized
+form of a title used in download file names.
+*/
+func (h *WatchHistory) IDForTitle(name string) (string, bool) {
+	for id, title := range h.Titles {
+		if title == name || sanitizeFileName(title) == name {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// IsWatched reports whether the given episode has been played before
+func (h *WatchHistory) IsWatched(animeID, episodeType, episode string) bool {
+	_, ok := h.Anime[animeID][episodeType][episode]
+	return ok
+}
+
+// MarkWatched records the given episode as played now
+func (h *WatchHistory) MarkWatched(animeID, episodeType, episode string) {
+	if animeID == "" || episode == "" {
+		return
+	}
+	if h.Anime[animeID] == nil {
+		h.Anime[animeID] = make(map[string]map[string]time.Time)
+	}
+	if h.Anime[animeID][episodeType] == nil {
+		h.Anime[animeID][episodeType] = make(map[string]time.Time)
+	}
+	h.Anime[animeID][episodeType][episode] = time.Now()
+}
+
+// Save writes the history back to disk, creating the parent directory if needed
+func (h *WatchHistory) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}